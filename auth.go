@@ -0,0 +1,117 @@
+package mds
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// Authorization schemes supported by AuthorizationHeader
+const (
+	SchemeBasic  = "Basic"
+	SchemeBearer = "Bearer"
+	SchemeOAuth  = "OAuth"
+)
+
+var authSchemes = []string{SchemeBasic, SchemeBearer, SchemeOAuth}
+
+// AuthorizationHeader assembles a value of Authorization header from a scheme and a token.
+// The scheme is matched case-insensitively, Basic is used if it's empty.
+func AuthorizationHeader(scheme, token string) (string, error) {
+	if scheme == "" {
+		scheme = SchemeBasic
+	}
+
+	for _, known := range authSchemes {
+		if strings.EqualFold(scheme, known) {
+			if token == "" {
+				return "", fmt.Errorf("empty token for %s authorization", known)
+			}
+			return known + " " + token, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown authorization scheme %q", scheme)
+}
+
+// BasicAuth returns a value of Authorization header for Basic scheme.
+func BasicAuth(user, password string) string {
+	return SchemeBasic + " " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
+
+// ValidateAuthHeader checks that header has a known scheme and a credential.
+// For Basic scheme the credential must be valid base64 of user:password.
+func ValidateAuthHeader(header string) error {
+	fields := strings.Fields(header)
+	if len(fields) != 2 {
+		return fmt.Errorf("malformed Authorization header: must be <scheme> <credentials>")
+	}
+	scheme, credentials := fields[0], fields[1]
+
+	known := false
+	for _, s := range authSchemes {
+		known = known || strings.EqualFold(scheme, s)
+	}
+	if !known {
+		return fmt.Errorf("unknown authorization scheme %q", scheme)
+	}
+
+	if strings.EqualFold(scheme, SchemeBasic) {
+		decoded, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			return fmt.Errorf("malformed Basic credentials: %v", err)
+		}
+		if !bytes.Contains(decoded, []byte(":")) {
+			return fmt.Errorf("malformed Basic credentials: must be user:password")
+		}
+	}
+	return nil
+}
+
+type contextKey struct {
+	name string
+}
+
+// AuthHeaderContextKey is a context key of a value of Authorization header.
+// The value must be a string. If it's present, it overrides Config.AuthHeader
+// for requests made with the context, so request scoped credentials
+// could be propagated from an HTTP handler. See WithAuthHeader.
+var AuthHeaderContextKey = &contextKey{"authorization"}
+
+// WithAuthHeader returns a copy of ctx carrying a value of Authorization header
+// to be used instead of Config.AuthHeader.
+func WithAuthHeader(ctx context.Context, header string) context.Context {
+	return context.WithValue(ctx, AuthHeaderContextKey, header)
+}
+
+// hasAuthOverride reports whether ctx carries credentials set by WithAuthHeader
+func hasAuthOverride(ctx context.Context) bool {
+	_, ok := ctx.Value(AuthHeaderContextKey).(string)
+	return ok
+}
+
+func (m *Client) authHeader(ctx context.Context) string {
+	if header, ok := ctx.Value(AuthHeaderContextKey).(string); ok {
+		return header
+	}
+	return m.AuthHeader
+}
+
+func (m *Client) newRequest(ctx context.Context, method, urlStr string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, urlStr, body)
+	if err != nil {
+		return nil, err
+	}
+	if header := m.authHeader(ctx); header != "" {
+		req.Header.Set("Authorization", header)
+	}
+	if m.HostHeader != "" {
+		req.Host = m.HostHeader
+	}
+	return req, nil
+}
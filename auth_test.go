@@ -0,0 +1,126 @@
+package mds
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestAuthorizationHeader(t *testing.T) {
+	for _, tc := range []struct {
+		scheme, token, header string
+	}{
+		{"", "dGVzdDp0ZXN0", "Basic dGVzdDp0ZXN0"},
+		{"basic", "dGVzdDp0ZXN0", "Basic dGVzdDp0ZXN0"},
+		{"Bearer", "token", "Bearer token"},
+		{"OAUTH", "token", "OAuth token"},
+	} {
+		header, err := AuthorizationHeader(tc.scheme, tc.token)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.header, header)
+	}
+
+	_, err := AuthorizationHeader("Digest", "token")
+	assert.Error(t, err)
+
+	_, err = AuthorizationHeader("Bearer", "")
+	assert.Error(t, err)
+}
+
+func TestClientAuthToken(t *testing.T) {
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	port := serverPort(t, srv)
+	cli, err := NewClient(Config{
+		Host:       "127.0.0.1",
+		UploadPort: port,
+		ReadPort:   port,
+		AuthScheme: "oauth",
+		AuthToken:  "secret",
+	}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	assert.NoError(t, cli.Ping(context.Background()))
+	assert.Equal(t, "OAuth secret", auth)
+
+	_, err = NewClient(Config{
+		Host:       "127.0.0.1",
+		AuthScheme: "Digest",
+		AuthToken:  "secret",
+	}, nil)
+	assert.Error(t, err)
+
+	_, err = NewClient(Config{
+		Host:       "127.0.0.1",
+		AuthHeader: "Basic dGVzdDp0ZXN0",
+		AuthToken:  "secret",
+	}, nil)
+	assert.Error(t, err)
+}
+
+func TestValidateAuthHeader(t *testing.T) {
+	for _, header := range []string{
+		BasicAuth("sandbox-tmp", "secret"),
+		"Basic c2FuZGJveC10bXA6YjUyZDVkZjk0ZDA0NTU2MTRiZDZmOWI3NDA3Mzk0OWI=",
+		"bearer token",
+		"OAuth token",
+	} {
+		assert.NoError(t, ValidateAuthHeader(header), header)
+	}
+
+	for _, header := range []string{
+		"",
+		"c2FuZGJveC10bXA6c2VjcmV0",
+		"Digest token",
+		"Basic c2FuZGJveC10bXA6YjUyZDVkZjk0ZDA0NTU2MTRiZDZmOWI3NDA3Mzk0O",
+		"Basic c2FuZGJveC10bXA=",
+		"Bearer a b",
+	} {
+		assert.Error(t, ValidateAuthHeader(header), header)
+	}
+}
+
+func TestNewClientValidateAuth(t *testing.T) {
+	_, err := NewClient(Config{
+		Host:         "127.0.0.1",
+		AuthHeader:   "Basic c2FuZGJveC10bXA6YjUyZDVkZjk0ZDA0NTU2MTR",
+		ValidateAuth: true,
+	}, nil)
+	assert.Error(t, err)
+
+	_, err = NewClient(Config{
+		Host:         "127.0.0.1",
+		AuthHeader:   BasicAuth("user", "password"),
+		ValidateAuth: true,
+	}, nil)
+	assert.NoError(t, err)
+}
+
+func TestContextAuthHeader(t *testing.T) {
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	assert.NoError(t, cli.Ping(ctx))
+	assert.Equal(t, cli.AuthHeader, auth)
+
+	assert.NoError(t, cli.Ping(WithAuthHeader(ctx, "OAuth user-token")))
+	assert.Equal(t, "OAuth user-token", auth)
+
+	assert.NoError(t, cli.Delete(context.WithValue(ctx, AuthHeaderContextKey, "Bearer token"), "ns", "1/key"))
+	assert.Equal(t, "Bearer token", auth)
+}
@@ -0,0 +1,154 @@
+package mds
+
+import (
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+const defaultBatchConcurrency = 16
+
+// limiter bounds a number of requests running concurrently.
+// It's shared by all batch methods of a client.
+type limiter chan struct{}
+
+func (l limiter) acquire(ctx context.Context) error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l limiter) release() {
+	<-l
+}
+
+// StatResult is a result of StatMany for a single key
+type StatResult struct {
+	Info *ObjectInfo
+	Err  error
+}
+
+// StatMany issues HEAD requests for keys concurrently, bounded by BatchConcurrency.
+// A failure of one key doesn't affect others: every key gets its own result.
+func (m *Client) StatMany(ctx context.Context, namespace string, keys []string) map[string]StatResult {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]StatResult, len(keys))
+	)
+
+	for _, key := range keys {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+
+			var result StatResult
+			if result.Err = m.batch.acquire(ctx); result.Err == nil {
+				result.Info, result.Err = m.stat(ctx, namespace, key)
+				m.batch.release()
+			}
+
+			mu.Lock()
+			results[key] = result
+			mu.Unlock()
+		}(key)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// UploadItem describes a single object for UploadMany
+type UploadItem struct {
+	Filename string
+	Size     int64
+	Body     io.Reader
+}
+
+// UploadResult is a result of UploadMany for a single item
+type UploadResult struct {
+	Info *UploadInfo
+	Err  error
+}
+
+// UploadMany uploads items concurrently, bounded by BatchConcurrency.
+// Results are in the same order as items. A failure of one item doesn't abort the others.
+// Options apply to every item.
+func (m *Client) UploadMany(ctx context.Context, namespace string, items []UploadItem, opts ...UploadOption) []UploadResult {
+	return m.BatchUpload(ctx, namespace, items, 0, opts...)
+}
+
+// BatchUpload uploads items with Upload using concurrency workers.
+// Requests are bounded by BatchConcurrency as well, so concurrency only lowers the limit.
+// BatchConcurrency is used if it's not positive.
+// Results are in the same order as items. A failure of one item doesn't abort the others.
+// Options apply to every item.
+func (m *Client) BatchUpload(ctx context.Context, namespace string, items []UploadItem, concurrency int, opts ...UploadOption) []UploadResult {
+	results := make([]UploadResult, len(items))
+	m.runBatch(ctx, len(items), concurrency, func(i int, err error) {
+		if err == nil {
+			item := items[i]
+			results[i].Info, err = m.Upload(ctx, namespace, item.Filename, item.Size, item.Body, opts...)
+		}
+		results[i].Err = err
+	})
+	return results
+}
+
+// runBatch calls fn for indexes in [0, n) using concurrency workers.
+// Calls are bounded by BatchConcurrency as well: fn gets an error
+// if ctx is done before its turn, then it must not make a request.
+func (m *Client) runBatch(ctx context.Context, n, concurrency int, fn func(i int, err error)) {
+	if concurrency <= 0 || concurrency > m.BatchConcurrency {
+		concurrency = m.BatchConcurrency
+	}
+
+	var (
+		wg   sync.WaitGroup
+		next = make(chan int)
+	)
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if err := m.batch.acquire(ctx); err != nil {
+					fn(i, err)
+					continue
+				}
+				fn(i, nil)
+				m.batch.release()
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// DeleteResult is a result of BatchDelete for a single key
+type DeleteResult struct {
+	Key string
+	Err error
+}
+
+// BatchDelete deletes keys with Delete using concurrency workers, so it's fine
+// for millions of keys. Requests are bounded by BatchConcurrency as well,
+// so concurrency only lowers the limit. BatchConcurrency is used if it's not positive.
+// Results are in the same order as keys. A failure of one key doesn't abort the others.
+func (m *Client) BatchDelete(ctx context.Context, namespace string, keys []string, concurrency int) []DeleteResult {
+	results := make([]DeleteResult, len(keys))
+	m.runBatch(ctx, len(keys), concurrency, func(i int, err error) {
+		if err == nil {
+			err = m.Delete(ctx, namespace, keys[i])
+		}
+		results[i] = DeleteResult{Key: keys[i], Err: err}
+	})
+	return results
+}
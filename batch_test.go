@@ -0,0 +1,200 @@
+package mds
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestStatMany(t *testing.T) {
+	const concurrency = 3
+	var inflight, maxInflight int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInflight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInflight, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		assert.Equal(t, "HEAD", r.Method)
+		if strings.HasSuffix(r.URL.Path, "missing") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Length", "42")
+	}))
+	defer srv.Close()
+
+	port := serverPort(t, srv)
+	cli, err := NewClient(Config{
+		Host:             "127.0.0.1",
+		UploadPort:       port,
+		ReadPort:         port,
+		BatchConcurrency: concurrency,
+	}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	var keys []string
+	for i := 0; i < 10; i++ {
+		keys = append(keys, fmt.Sprintf("1/key%d", i))
+	}
+	keys = append(keys, "1/missing")
+
+	results := cli.StatMany(context.Background(), "ns", keys)
+	assert.Len(t, results, len(keys))
+	for _, key := range keys[:10] {
+		if assert.NoError(t, results[key].Err, key) {
+			assert.Equal(t, int64(42), results[key].Info.Size)
+		}
+	}
+
+	var mErr MethodError
+	if assert.True(t, errors.As(results["1/missing"].Err, &mErr)) {
+		assert.Equal(t, http.StatusNotFound, mErr.StatusCode)
+	}
+
+	assert.True(t, atomic.LoadInt32(&maxInflight) <= concurrency)
+}
+
+func TestStatManyCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := newTestClient(t, srv).StatMany(ctx, "ns", []string{"1/a", "1/b"})
+	for _, result := range results {
+		assert.Error(t, result.Err)
+	}
+}
+
+func TestUploadMany(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "broken") {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, `<post obj="ns.file" id="0:1" groups="2" size="%d" key="1/%s"><written>2</written></post>`,
+			len(body), strings.TrimPrefix(r.URL.Path, "/upload-ns/"))
+	}))
+	defer srv.Close()
+
+	items := []UploadItem{
+		{Filename: "a", Size: 1, Body: strings.NewReader("A")},
+		{Filename: "broken", Size: 1, Body: strings.NewReader("B")},
+		{Filename: "c", Size: 3, Body: strings.NewReader("CCC")},
+	}
+	results := newTestClient(t, srv).UploadMany(context.Background(), "ns", items)
+	if !assert.Len(t, results, len(items)) {
+		t.FailNow()
+	}
+
+	if assert.NoError(t, results[0].Err) {
+		assert.Equal(t, "1/a", results[0].Info.Key)
+		assert.Equal(t, "a", results[0].Info.Filename)
+	}
+	assert.Error(t, results[1].Err)
+	assert.Nil(t, results[1].Info)
+	if assert.NoError(t, results[2].Err) {
+		assert.Equal(t, "1/c", results[2].Info.Key)
+		assert.Equal(t, uint64(3), results[2].Info.Size)
+	}
+}
+
+func TestBatchUpload(t *testing.T) {
+	var inflight, maxInflight int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInflight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInflight, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, `<post obj="ns.file" id="0:1" groups="2" size="4" key="1/%s"><written>2</written></post>`,
+			strings.TrimPrefix(r.URL.Path, "/upload-ns/"))
+	}))
+	defer srv.Close()
+
+	var items []UploadItem
+	for i := 0; i < 5; i++ {
+		items = append(items, UploadItem{Filename: fmt.Sprintf("file%d", i), Size: 4, Body: strings.NewReader("TEST")})
+	}
+	results := newTestClient(t, srv).BatchUpload(context.Background(), "ns", items, 1)
+	if assert.Len(t, results, len(items)) {
+		for i, result := range results {
+			if assert.NoError(t, result.Err) {
+				assert.Equal(t, fmt.Sprintf("1/file%d", i), result.Info.Key)
+			}
+		}
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxInflight))
+}
+
+func TestBatchDelete(t *testing.T) {
+	const concurrency = 2
+	var inflight, maxInflight int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inflight, 1)
+		defer atomic.AddInt32(&inflight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInflight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInflight, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		assert.True(t, strings.HasPrefix(r.URL.Path, "/delete-ns/"))
+		if strings.HasSuffix(r.URL.Path, "missing") {
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+
+	var keys []string
+	for i := 0; i < 10; i++ {
+		keys = append(keys, fmt.Sprintf("1/key%d", i))
+	}
+	keys = append(keys, "1/missing")
+
+	results := cli.BatchDelete(context.Background(), "ns", keys, concurrency)
+	if assert.Len(t, results, len(keys)) {
+		for i, key := range keys[:10] {
+			assert.Equal(t, key, results[i].Key)
+			assert.NoError(t, results[i].Err, key)
+		}
+		assert.Equal(t, "1/missing", results[10].Key)
+		assert.True(t, errors.Is(results[10].Err, ErrKeyNotFound))
+	}
+	assert.True(t, atomic.LoadInt32(&maxInflight) <= concurrency)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, result := range cli.BatchDelete(ctx, "ns", keys, 0) {
+		assert.Error(t, result.Err)
+	}
+}
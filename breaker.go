@@ -0,0 +1,199 @@
+package mds
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultBreakerCooldown is used if BreakerPolicy.Cooldown is not set
+const DefaultBreakerCooldown = 10 * time.Second
+
+// ErrCircuitOpen is returned without sending a request to a proxy endpoint
+// while its circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerPolicy configures circuit breakers, which are kept per proxy endpoint (host:port).
+// Transport failures and 5xx replies count as failures of an endpoint.
+// Once Threshold consecutive failures happen, requests to the endpoint fail
+// with ErrCircuitOpen for Cooldown. Then a single probe request is let through:
+// its success closes the breaker, a failure opens it for another Cooldown.
+type BreakerPolicy struct {
+	// Threshold of consecutive failures. Zero disables circuit breakers.
+	Threshold int
+	Cooldown  time.Duration
+}
+
+// BreakerState is a state of a circuit breaker of an endpoint
+type BreakerState int
+
+const (
+	// BreakerClosed lets requests through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects requests
+	BreakerOpen
+	// BreakerHalfOpen waits for a probe request to finish
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+type breaker struct {
+	state    BreakerState
+	failures int
+	openedAt time.Time
+}
+
+// breakerTransport keeps circuit breakers of endpoints requested through it
+type breakerTransport struct {
+	next   http.RoundTripper
+	policy BreakerPolicy
+	clock  Clock
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func newBreakerTransport(next http.RoundTripper, policy BreakerPolicy) *breakerTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	if policy.Cooldown <= 0 {
+		policy.Cooldown = DefaultBreakerCooldown
+	}
+	return &breakerTransport{
+		next:     next,
+		policy:   policy,
+		clock:    realClock{},
+		breakers: make(map[string]*breaker),
+	}
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := req.URL.Host
+	if !t.allow(endpoint) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, endpoint)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil && req.Context().Err() != nil:
+		// the caller gave up, the endpoint is not to blame
+		t.release(endpoint)
+	case err != nil || resp.StatusCode >= 500:
+		t.failure(endpoint)
+	default:
+		t.success(endpoint)
+	}
+	return resp, err
+}
+
+// CloseIdleConnections lets http.Client reach the wrapped transport
+func (t *breakerTransport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+func (t *breakerTransport) allow(endpoint string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, ok := t.breakers[endpoint]
+	if !ok {
+		return true
+	}
+	switch b.state {
+	case BreakerOpen:
+		if t.clock.Now().Sub(b.openedAt) < t.policy.Cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		return true
+	case BreakerHalfOpen:
+		// a probe is in flight
+		return false
+	default:
+		return true
+	}
+}
+
+func (t *breakerTransport) success(endpoint string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.breakers, endpoint)
+}
+
+func (t *breakerTransport) failure(endpoint string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, ok := t.breakers[endpoint]
+	if !ok {
+		b = &breaker{}
+		t.breakers[endpoint] = b
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= t.policy.Threshold {
+		b.state = BreakerOpen
+		b.openedAt = t.clock.Now()
+	}
+}
+
+// release lets another probe through if an interrupted request was a probe
+func (t *breakerTransport) release(endpoint string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if b, ok := t.breakers[endpoint]; ok && b.state == BreakerHalfOpen {
+		b.state = BreakerOpen
+	}
+}
+
+func (t *breakerTransport) states() map[string]BreakerState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	states := make(map[string]BreakerState, len(t.breakers))
+	for endpoint, b := range t.breakers {
+		states[endpoint] = b.state
+	}
+	return states
+}
+
+// BreakerStates returns states of circuit breakers by endpoint (host:port) for monitoring.
+// Endpoints without recent failures are omitted, their breakers are closed.
+// It's nil if breakers are disabled.
+func (m *Client) BreakerStates() map[string]BreakerState {
+	if m.breakers == nil {
+		return nil
+	}
+	return m.breakers.states()
+}
+
+// withBreakers returns a copy of client with circuit breakers in front of its transport
+func withBreakers(client *http.Client, policy BreakerPolicy) (*http.Client, *breakerTransport) {
+	if policy.Threshold <= 0 {
+		return client, nil
+	}
+	transport := newBreakerTransport(client.Transport, policy)
+	bclient := *client
+	bclient.Transport = transport
+	return &bclient, transport
+}
@@ -0,0 +1,93 @@
+package mds
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var requests, status int32 = 0, http.StatusBadGateway
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer srv.Close()
+
+	port := serverPort(t, srv)
+	cli, err := NewClient(Config{
+		Host:       "127.0.0.1",
+		UploadPort: port,
+		ReadPort:   port,
+		Breaker:    BreakerPolicy{Threshold: 2, Cooldown: time.Minute},
+		Retry:      RetryPolicy{MaxAttempts: 5},
+	}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	clk := newFakeClock()
+	cli.setClock(clk)
+	ctx := context.Background()
+	endpoint := srv.Listener.Addr().String()
+
+	assert.Empty(t, cli.BreakerStates())
+
+	// retries stop once the breaker opens
+	err = cli.Ping(ctx)
+	assert.True(t, errors.Is(err, ErrCircuitOpen), "%v", err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	assert.Equal(t, map[string]BreakerState{endpoint: BreakerOpen}, cli.BreakerStates())
+
+	clk.Advance(30 * time.Second)
+	assert.True(t, errors.Is(cli.Ping(ctx), ErrCircuitOpen))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// a failed probe opens the breaker for another cooldown
+	clk.Advance(time.Minute)
+	cli.Retry.MaxAttempts = 0
+	var mErr MethodError
+	if assert.True(t, errors.As(cli.Ping(ctx), &mErr)) {
+		assert.Equal(t, http.StatusBadGateway, mErr.StatusCode)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	assert.True(t, errors.Is(cli.Ping(ctx), ErrCircuitOpen))
+	assert.Equal(t, BreakerOpen, cli.BreakerStates()[endpoint])
+
+	clk.Advance(time.Minute)
+	atomic.StoreInt32(&status, http.StatusOK)
+	assert.NoError(t, cli.Ping(ctx))
+	assert.Empty(t, cli.BreakerStates())
+
+	// 4xx replies don't count as failures
+	atomic.StoreInt32(&status, http.StatusNotFound)
+	for i := 0; i < 3; i++ {
+		assert.True(t, errors.Is(cli.Ping(ctx), ErrKeyNotFound))
+	}
+	assert.Empty(t, cli.BreakerStates())
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	for i := 0; i < 10; i++ {
+		assert.False(t, errors.Is(cli.Ping(context.Background()), ErrCircuitOpen))
+	}
+	assert.Nil(t, cli.BreakerStates())
+}
+
+func TestBreakerStateString(t *testing.T) {
+	assert.Equal(t, "closed", BreakerClosed.String())
+	assert.Equal(t, "open", BreakerOpen.String())
+	assert.Equal(t, "half-open", BreakerHalfOpen.String())
+	assert.Equal(t, "BreakerState(7)", BreakerState(7).String())
+}
@@ -0,0 +1,139 @@
+package mds
+
+import (
+	"bytes"
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// maxExactRead limits Content-Length trusted to preallocate a body
+const maxExactRead = 64 << 20
+
+// DefaultCopyBufferSize is used if Config.CopyBufferSize is not set, it's the same as io.Copy uses
+const DefaultCopyBufferSize = 32 << 10
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(Buffer)
+	},
+}
+
+// Buffer holds a body read by GetFilePooled.
+// It must be released once the data is no longer needed.
+type Buffer struct {
+	buf bytes.Buffer
+}
+
+// Bytes returns the body. The slice is valid only until Release.
+func (b *Buffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// Release returns the buffer to the pool. The buffer must not be used after that.
+func (b *Buffer) Release() {
+	b.buf.Reset()
+	bufferPool.Put(b)
+}
+
+// GetFilePooled is like GetFile, but reads the body into a pooled Buffer,
+// so a hot read path doesn't allocate a slice for every object.
+// User is responsible for calling Release.
+func (m *Client) GetFilePooled(ctx context.Context, namespace, key string, Range ...uint64) (*Buffer, error) {
+	resp, err := m.get(ctx, namespace, key, Range...)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b := bufferPool.Get().(*Buffer)
+	if resp.ContentLength > 0 && resp.ContentLength <= maxExactRead {
+		b.buf.Grow(int(resp.ContentLength))
+	}
+	if _, err := b.buf.ReadFrom(resp.Body); err != nil {
+		b.Release()
+		return nil, err
+	}
+	return b, nil
+}
+
+// GetFileAppend is like GetFile, but appends the body to dst and returns the extended slice,
+// so a hot read path may reuse a single slice: dst = cli.GetFileAppend(ctx, dst[:0], ...).
+// dst is grown only if it lacks capacity. Along with an error dst is returned as is.
+func (m *Client) GetFileAppend(ctx context.Context, dst []byte, namespace, key string, Range ...uint64) ([]byte, error) {
+	resp, err := m.get(ctx, namespace, key, Range...)
+	if err != nil {
+		return dst, err
+	}
+	defer resp.Body.Close()
+
+	if resp.ContentLength < 0 || resp.ContentLength > maxExactRead {
+		body, err := appendAll(dst, resp.Body)
+		if err != nil {
+			return dst, err
+		}
+		return body, nil
+	}
+
+	n := int(resp.ContentLength)
+	body := dst
+	if cap(body)-len(body) < n {
+		body = make([]byte, len(dst), len(dst)+n)
+		copy(body, dst)
+	}
+	if _, err := io.ReadFull(resp.Body, body[len(body):len(body)+n]); err != nil {
+		return dst, err
+	}
+	return body[:len(body)+n], nil
+}
+
+// appendAll reads r till EOF appending to dst
+func appendAll(dst []byte, r io.Reader) ([]byte, error) {
+	for {
+		if len(dst) == cap(dst) {
+			dst = append(dst, 0)[:len(dst)]
+		}
+		n, err := r.Read(dst[len(dst):cap(dst)])
+		dst = dst[:len(dst)+n]
+		if err == io.EOF {
+			return dst, nil
+		}
+		if err != nil {
+			return dst, err
+		}
+	}
+}
+
+func newCopyBufferPool(size int) *sync.Pool {
+	if size <= 0 {
+		size = DefaultCopyBufferSize
+	}
+	return &sync.Pool{
+		New: func() interface{} {
+			buf := make([]byte, size)
+			return &buf
+		},
+	}
+}
+
+// copy copies src to dst with a pooled buffer of CopyBufferSize
+func (m *Client) copy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := m.copyBuffers.Get().(*[]byte)
+	defer m.copyBuffers.Put(buf)
+	// hide io.ReaderFrom and io.WriterTo, they would copy with buffers of their own
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buf)
+}
+
+// DownloadTo streams key to w without buffering the whole object in memory,
+// unlike GetFile. It returns a number of bytes written.
+// Bytes are copied with a pooled buffer of Config.CopyBufferSize.
+func (m *Client) DownloadTo(ctx context.Context, namespace, key string, w io.Writer) (int64, error) {
+	resp, err := m.get(ctx, namespace, key)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	return m.copy(w, resp.Body)
+}
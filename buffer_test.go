@@ -0,0 +1,227 @@
+package mds
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func newBlobServer(blob []byte, chunked bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !chunked {
+			w.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+		}
+		io.Copy(w, bytes.NewReader(blob))
+	}))
+}
+
+func TestGetFileExactAndPooled(t *testing.T) {
+	blob := bytes.Repeat([]byte("TESTBLOB"), 1024)
+	for _, chunked := range []bool{false, true} {
+		srv := newBlobServer(blob, chunked)
+		cli := newTestClient(t, srv)
+		ctx := context.Background()
+
+		body, err := cli.GetFile(ctx, "ns", "1/key")
+		assert.NoError(t, err)
+		assert.Equal(t, blob, body)
+
+		buf, err := cli.GetFilePooled(ctx, "ns", "1/key")
+		if assert.NoError(t, err) {
+			assert.Equal(t, blob, buf.Bytes())
+			buf.Release()
+		}
+
+		srv.Close()
+	}
+}
+
+func TestGetFileAppend(t *testing.T) {
+	blob := bytes.Repeat([]byte("TESTBLOB"), 1024)
+	for _, chunked := range []bool{false, true} {
+		srv := newBlobServer(blob, chunked)
+		cli := newTestClient(t, srv)
+		ctx := context.Background()
+
+		dst, err := cli.GetFileAppend(ctx, []byte("HEAD"), "ns", "1/key")
+		assert.NoError(t, err)
+		assert.Equal(t, append([]byte("HEAD"), blob...), dst)
+
+		// a slice with enough capacity is reused
+		buf := make([]byte, 0, 2*len(blob))
+		dst, err = cli.GetFileAppend(ctx, buf, "ns", "1/key")
+		assert.NoError(t, err)
+		assert.Equal(t, blob, dst)
+		assert.True(t, &buf[:1][0] == &dst[0], "chunked %v", chunked)
+
+		srv.Close()
+	}
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	dst, err := newTestClient(t, srv).GetFileAppend(context.Background(), []byte("HEAD"), "ns", "1/key")
+	assert.Error(t, err)
+	assert.Equal(t, "HEAD", string(dst))
+}
+
+// maxWriter records the largest write
+type maxWriter struct {
+	bytes.Buffer
+	max int
+}
+
+func (w *maxWriter) Write(p []byte) (int, error) {
+	if len(p) > w.max {
+		w.max = len(p)
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestDownloadTo(t *testing.T) {
+	blob := bytes.Repeat([]byte("TESTBLOB"), 1024)
+	srv := newBlobServer(blob, false)
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	var w maxWriter
+	n, err := cli.DownloadTo(ctx, "ns", "1/key", &w)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(blob)), n)
+	assert.Equal(t, blob, w.Bytes())
+	assert.True(t, w.max <= DefaultCopyBufferSize)
+
+	cli.copyBuffers = newCopyBufferPool(100)
+	w = maxWriter{}
+	n, err = cli.DownloadTo(ctx, "ns", "1/key", &w)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(blob)), n)
+	assert.Equal(t, blob, w.Bytes())
+	assert.True(t, w.max <= 100, "%d", w.max)
+}
+
+func TestGetFileExactCapacity(t *testing.T) {
+	blob := bytes.Repeat([]byte("TESTBLOB"), 1000)
+	srv := newBlobServer(blob, false)
+	defer srv.Close()
+
+	body, err := newTestClient(t, srv).GetFile(context.Background(), "ns", "1/key")
+	assert.NoError(t, err)
+	assert.Equal(t, len(blob), cap(body))
+}
+
+func benchmarkGetFile(b *testing.B, chunked, pooled bool) {
+	blob := bytes.Repeat([]byte("TESTBLOB"), 8*1024)
+	srv := newBlobServer(blob, chunked)
+	defer srv.Close()
+
+	cli := newTestClient(b, srv)
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if pooled {
+			buf, err := cli.GetFilePooled(ctx, "ns", "1/key")
+			if err != nil {
+				b.Fatal(err)
+			}
+			buf.Release()
+			continue
+		}
+		if _, err := cli.GetFile(ctx, "ns", "1/key"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetFileUnknownLength(b *testing.B) {
+	benchmarkGetFile(b, true, false)
+}
+
+func BenchmarkGetFileKnownLength(b *testing.B) {
+	benchmarkGetFile(b, false, false)
+}
+
+func BenchmarkGetFilePooled(b *testing.B) {
+	benchmarkGetFile(b, false, true)
+}
+
+func BenchmarkGetFileAppend(b *testing.B) {
+	blob := bytes.Repeat([]byte("TESTBLOB"), 8*1024)
+	srv := newBlobServer(blob, false)
+	defer srv.Close()
+
+	cli := newTestClient(b, srv)
+	ctx := context.Background()
+
+	var dst []byte
+	var err error
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if dst, err = cli.GetFileAppend(ctx, dst[:0], "ns", "1/key"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// latencyConn delays every read, as a link with a high latency does
+// for a reader waiting for the next portion of data
+type latencyConn struct {
+	net.Conn
+	delay time.Duration
+}
+
+func (c latencyConn) Read(p []byte) (int, error) {
+	time.Sleep(c.delay)
+	return c.Conn.Read(p)
+}
+
+func BenchmarkDownloadToBufferSize(b *testing.B) {
+	blob := bytes.Repeat([]byte("TESTBLOB"), 512*1024)
+	srv := newBlobServer(blob, false)
+	defer srv.Close()
+
+	for _, size := range []int{4 << 10, DefaultCopyBufferSize, 256 << 10, 1 << 20} {
+		b.Run(strconv.Itoa(size>>10)+"KiB", func(b *testing.B) {
+			var dialer net.Dialer
+			port := serverPort(b, srv)
+			cli, err := NewClient(Config{
+				Host:           "127.0.0.1",
+				UploadPort:     port,
+				ReadPort:       port,
+				CopyBufferSize: size,
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					conn, err := dialer.DialContext(ctx, network, addr)
+					if err != nil {
+						return nil, err
+					}
+					return latencyConn{Conn: conn, delay: 100 * time.Microsecond}, nil
+				},
+			}, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			ctx := context.Background()
+
+			b.SetBytes(int64(len(blob)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := cli.DownloadTo(ctx, "ns", "1/key", ioutil.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,640 @@
+package mds
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// Cache stores bodies of objects read from a proxy, so repeated reads
+// of immutable objects don't hit the proxy. Implementations must be safe
+// for concurrent use.
+type Cache interface {
+	// Get returns a cached entry of key. ok is false on a miss.
+	Get(key string) (entry *CacheEntry, ok bool)
+	// Put starts storing a new entry of key replacing an old one.
+	// header holds metadata of the reply, see CacheEntry.Header.
+	// The entry must appear only after Commit, so partially read bodies are never cached.
+	Put(key string, header http.Header) (CacheWriter, error)
+	// Remove drops an entry of key.
+	Remove(key string)
+}
+
+// CacheFlusher is implemented by caches able to drop all entries at once
+type CacheFlusher interface {
+	Flush() error
+}
+
+// InvalidateCache drops a cached body of key, e.g. after the object
+// is overwritten out-of-band. It does nothing if Cache is not set.
+func (m *Client) InvalidateCache(namespace, key string) {
+	if m.Cache != nil {
+		m.Cache.Remove(cacheKey(namespace, key))
+	}
+}
+
+// FlushCaches drops all cached bodies. Cache must implement CacheFlusher.
+func (m *Client) FlushCaches() error {
+	if m.Cache == nil {
+		return nil
+	}
+	flusher, ok := m.Cache.(CacheFlusher)
+	if !ok {
+		return fmt.Errorf("cache %T can't be flushed", m.Cache)
+	}
+	return flusher.Flush()
+}
+
+// CacheEntry is a cached body of an object
+type CacheEntry struct {
+	// ETag is used to revalidate the entry. An entry without ETag is served
+	// without asking the proxy.
+	ETag string
+	// Header holds metadata headers of the reply which filled the entry,
+	// see cachedHeaders. They are restored on a hit.
+	Header http.Header
+	Size   int64
+	Body   io.ReadCloser
+}
+
+// cachedHeaders are kept along with a cached body,
+// so a hit carries the same metadata as a reply of the proxy
+var cachedHeaders = []string{
+	"Content-Type",
+	"ETag",
+	"Last-Modified",
+	"Expires",
+	"Accept-Ranges",
+	"Cache-Control",
+}
+
+// cacheHeader returns cachedHeaders of a reply
+func cacheHeader(reply http.Header) http.Header {
+	header := make(http.Header)
+	for _, name := range cachedHeaders {
+		if values := reply.Values(name); len(values) > 0 {
+			header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+	return header
+}
+
+// CacheWriter stores a body of a new cache entry
+type CacheWriter interface {
+	io.Writer
+	// Commit makes the entry visible.
+	Commit() error
+	// Abort discards written data.
+	Abort() error
+}
+
+func cacheKey(namespace, key string) string {
+	return namespace + "/" + key
+}
+
+func (e *CacheEntry) response() *http.Response {
+	header := cacheHeader(e.Header)
+	if e.ETag != "" {
+		header.Set("ETag", e.ETag)
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		ContentLength: e.Size,
+		Body:          e.Body,
+	}
+}
+
+// coalesceMaxSize limits bodies buffered to be shared by concurrent misses of a key.
+// Larger ones are streamed, so concurrent misses fetch them on their own.
+const coalesceMaxSize = 1 << 20
+
+func (m *Client) getCached(ctx context.Context, namespace, key string, req *http.Request) (*http.Response, error) {
+	ckey := cacheKey(namespace, key)
+	entry, cached := m.Cache.Get(ckey)
+	if cached && entry.ETag == "" {
+		return entry.response(), nil
+	}
+
+	// concurrent reads of the same key wait for a single request to be replied.
+	// If someone waits, the leader reads the body itself to share it,
+	// so a reader holding a body open never blocks others.
+	f, leader := m.flights.join(ckey)
+	if !leader {
+		select {
+		case <-f.done:
+		case <-ctx.Done():
+			if cached {
+				entry.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+		switch {
+		case cached && entry.ETag == f.revalidated:
+			return entry.response(), nil
+		case f.entry != nil:
+			if cached {
+				entry.Body.Close()
+			}
+			return f.entry.response(), nil
+		}
+		// the leader failed or streamed the body, so go on without coalescing
+		f = nil
+	}
+	leave := func() {
+		if f != nil {
+			m.flights.leave(ckey, f)
+		}
+	}
+
+	if cached {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+
+	resp, err := ctxhttp.Do(ctx, m.client, req)
+	if err != nil {
+		leave()
+		if cached {
+			entry.Body.Close()
+		}
+		return nil, err
+	}
+
+	if cached && resp.StatusCode == http.StatusNotModified {
+		if f != nil {
+			f.revalidated = entry.ETag
+		}
+		leave()
+		resp.Body.Close()
+		return entry.response(), nil
+	}
+	if cached {
+		entry.Body.Close()
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		leave()
+		defer resp.Body.Close()
+		scope := ErrorMethodScope{
+			Method:    "get",
+			URL:       req.URL.String(),
+			Namespace: namespace,
+			Key:       key,
+		}
+		return nil, newMethodError(scope, resp)
+	}
+
+	resp.Body = &resetClassifyingBody{resp.Body}
+
+	if f != nil && resp.ContentLength >= 0 && resp.ContentLength <= coalesceMaxSize && m.flights.followed(ckey, f) {
+		defer leave()
+		return m.shareBody(ckey, f, resp)
+	}
+	leave()
+
+	// caching is the best effort, a failure must not break a read
+	w, err := m.Cache.Put(ckey, cacheHeader(resp.Header))
+	if err != nil {
+		return resp, nil
+	}
+	resp.Body = &cachingBody{ReadCloser: resp.Body, w: w}
+	return resp, nil
+}
+
+// shareBody reads a body of the leader's reply, caches it and shares it with followers of f
+func (m *Client) shareBody(ckey string, f *flight, resp *http.Response) (*http.Response, error) {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	header := cacheHeader(resp.Header)
+	// caching is the best effort, a failure must not break a read
+	if w, err := m.Cache.Put(ckey, header); err == nil {
+		if _, err := w.Write(body); err == nil {
+			w.Commit()
+		} else {
+			w.Abort()
+		}
+	}
+
+	f.entry = &sharedEntry{header: header, body: body}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// sharedEntry is a body fetched by the leader of a flight
+type sharedEntry struct {
+	header http.Header
+	body   []byte
+}
+
+func (e *sharedEntry) response() *http.Response {
+	entry := &CacheEntry{
+		ETag:   e.header.Get("ETag"),
+		Header: e.header,
+		Size:   int64(len(e.body)),
+		Body:   ioutil.NopCloser(bytes.NewReader(e.body)),
+	}
+	return entry.response()
+}
+
+// flightGroup tracks keys being requested to revalidate or fill a cache
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a request of the leader, its result is set before done is closed
+type flight struct {
+	done chan struct{}
+	// revalidated is ETag of an entry confirmed by 304 reply
+	revalidated string
+	// entry is a body read by the leader, it's nil if the body is streamed
+	entry *sharedEntry
+	// followers is a number of readers waiting for the flight
+	followers int
+}
+
+// join returns a flight of key.
+// The first caller is the leader, it must call leave once it's replied.
+func (g *flightGroup) join(key string) (f *flight, leader bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if f, ok := g.flights[key]; ok {
+		f.followers++
+		return f, false
+	}
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f = &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	return f, true
+}
+
+// followed reports whether f has followers. If it hasn't,
+// f is closed for new ones, so the leader is free to stream the body.
+func (g *flightGroup) followed(key string, f *flight) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if f.followers > 0 {
+		return true
+	}
+	delete(g.flights, key)
+	return false
+}
+
+func (g *flightGroup) leave(key string, f *flight) {
+	g.mu.Lock()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	g.mu.Unlock()
+	close(f.done)
+}
+
+// cachingBody copies a body to a cache entry while it's read.
+// The entry is committed once the body is read till EOF.
+type cachingBody struct {
+	io.ReadCloser
+	w    CacheWriter
+	done bool
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.done {
+		return n, err
+	}
+
+	if n > 0 {
+		if _, werr := b.w.Write(p[:n]); werr != nil {
+			b.abort()
+			return n, err
+		}
+	}
+
+	switch {
+	case err == io.EOF:
+		b.w.Commit()
+		b.done = true
+	case err != nil:
+		b.abort()
+	}
+	return n, err
+}
+
+func (b *cachingBody) Close() error {
+	if !b.done {
+		b.abort()
+	}
+	return b.ReadCloser.Close()
+}
+
+func (b *cachingBody) abort() {
+	b.w.Abort()
+	b.done = true
+}
+
+const (
+	fsCacheHeaderSuffix = ".header"
+	fsCacheTempSuffix   = ".tmp"
+)
+
+// FSCache is a Cache keeping entries as files in a directory.
+// The least recently used entries are evicted when the total size exceeds a limit.
+type FSCache struct {
+	dir     string
+	maxSize int64
+
+	mu   sync.Mutex
+	size int64
+	// gen is bumped by Remove and Flush, so bodies being stored
+	// at that moment are discarded instead of committing stale data.
+	gen     uint64
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type fsCacheEntry struct {
+	name   string
+	header http.Header
+	size   int64
+}
+
+// NewFSCache creates a cache in dir limited by maxSize bytes.
+// Entries left in dir by a previous run are picked up,
+// files not named like entries are ignored.
+func NewFSCache(dir string, maxSize int64) (*FSCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	c := &FSCache{
+		dir:     dir,
+		maxSize: maxSize,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	// the most recently modified files go to the front
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	for _, file := range files {
+		name := file.Name()
+		// dir may be shared, so files of other owners are left alone
+		switch {
+		case file.IsDir():
+		case isFSCacheTemp(name):
+			os.Remove(filepath.Join(dir, name))
+		case strings.HasSuffix(name, fsCacheHeaderSuffix):
+			body := strings.TrimSuffix(name, fsCacheHeaderSuffix)
+			if isFSCacheName(body) {
+				if _, err := os.Stat(filepath.Join(dir, body)); os.IsNotExist(err) {
+					os.Remove(filepath.Join(dir, name))
+				}
+			}
+		case isFSCacheName(name):
+			header, err := readCacheHeader(filepath.Join(dir, name+fsCacheHeaderSuffix))
+			if err != nil {
+				// e.g. an entry of an older version without metadata
+				os.Remove(filepath.Join(dir, name))
+				continue
+			}
+			entry := &fsCacheEntry{name: name, header: header, size: file.Size()}
+			c.entries[name] = c.lru.PushBack(entry)
+			c.size += entry.size
+		}
+	}
+
+	// maxSize might have been lowered since the previous run
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// isFSCacheName reports whether name is a body of an entry, i.e. a hex sha256 of a key
+func isFSCacheName(name string) bool {
+	if len(name) != hex.EncodedLen(sha256.Size) {
+		return false
+	}
+	for _, r := range name {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// isFSCacheTemp reports whether name is a body being stored, see FSCache.Put
+func isFSCacheTemp(name string) bool {
+	if !strings.HasSuffix(name, fsCacheTempSuffix) {
+		return false
+	}
+	i := strings.IndexByte(name, '.')
+	return i >= 0 && isFSCacheName(name[:i])
+}
+
+func (c *FSCache) fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get implements Cache
+func (c *FSCache) Get(key string) (*CacheEntry, bool) {
+	name := c.fileName(key)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[name]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*fsCacheEntry)
+
+	file, err := os.Open(filepath.Join(c.dir, name))
+	if err != nil {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+
+	return &CacheEntry{
+		ETag:   entry.header.Get("ETag"),
+		Header: cacheHeader(entry.header),
+		Size:   entry.size,
+		Body:   file,
+	}, true
+}
+
+func readCacheHeader(path string) (http.Header, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// the header is stored by http.Header.Write, which omits the final empty line
+	data = append(data, "\r\n"...)
+	header, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(data))).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	return http.Header(header), nil
+}
+
+// Put implements Cache
+func (c *FSCache) Put(key string, header http.Header) (CacheWriter, error) {
+	name := c.fileName(key)
+	file, err := ioutil.TempFile(c.dir, name+".*"+fsCacheTempSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	gen := c.gen
+	c.mu.Unlock()
+
+	return &fsCacheWriter{
+		cache:  c,
+		file:   file,
+		name:   name,
+		header: cacheHeader(header),
+		gen:    gen,
+	}, nil
+}
+
+// Remove implements Cache.
+// Bodies being stored concurrently are discarded on Commit.
+func (c *FSCache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if elem, ok := c.entries[c.fileName(key)]; ok {
+		c.remove(elem)
+	}
+}
+
+// Flush implements CacheFlusher.
+// Bodies being stored concurrently are discarded on Commit.
+func (c *FSCache) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	for c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+	return nil
+}
+
+// Size returns the total size of cached entries.
+func (c *FSCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *FSCache) commit(entry *fsCacheEntry, gen uint64, tmpPath string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		// the body might be stale
+		return os.Remove(tmpPath)
+	}
+
+	if elem, ok := c.entries[entry.name]; ok {
+		c.remove(elem)
+	}
+
+	path := filepath.Join(c.dir, entry.name)
+	var header bytes.Buffer
+	entry.header.Write(&header)
+	if err := ioutil.WriteFile(path+fsCacheHeaderSuffix, header.Bytes(), 0644); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		os.Remove(path + fsCacheHeaderSuffix)
+		return err
+	}
+
+	c.entries[entry.name] = c.lru.PushFront(entry)
+	c.size += entry.size
+	c.evict()
+	return nil
+}
+
+// remove must be called with mu held
+func (c *FSCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*fsCacheEntry)
+	delete(c.entries, entry.name)
+	c.size -= entry.size
+
+	path := filepath.Join(c.dir, entry.name)
+	os.Remove(path)
+	os.Remove(path + fsCacheHeaderSuffix)
+}
+
+// evict must be called with mu held
+func (c *FSCache) evict() {
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+type fsCacheWriter struct {
+	cache  *FSCache
+	file   *os.File
+	name   string
+	header http.Header
+	size   int64
+	gen    uint64
+}
+
+func (w *fsCacheWriter) Write(p []byte) (int, error) {
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *fsCacheWriter) Commit() error {
+	if err := w.file.Close(); err != nil {
+		os.Remove(w.file.Name())
+		return err
+	}
+	return w.cache.commit(&fsCacheEntry{name: w.name, header: w.header, size: w.size}, w.gen, w.file.Name())
+}
+
+func (w *fsCacheWriter) Abort() error {
+	w.file.Close()
+	return os.Remove(w.file.Name())
+}
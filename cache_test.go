@@ -0,0 +1,371 @@
+package mds
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func putCache(t *testing.T, c Cache, key, etag, body string) {
+	header := make(http.Header)
+	if etag != "" {
+		header.Set("ETag", etag)
+	}
+	w, err := c.Put(key, header)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, err = w.Write([]byte(body))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Commit())
+}
+
+func readCache(t *testing.T, c Cache, key string) (string, string, bool) {
+	entry, ok := c.Get(key)
+	if !ok {
+		return "", "", false
+	}
+	defer entry.Body.Close()
+	body, err := ioutil.ReadAll(entry.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(body)), entry.Size)
+	return string(body), entry.ETag, true
+}
+
+func TestFSCache(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewFSCache(dir, 10)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	_, _, ok := readCache(t, c, "ns/1/a")
+	assert.False(t, ok)
+
+	putCache(t, c, "ns/1/a", `"a"`, "aaaa")
+	putCache(t, c, "ns/1/b", "", "bbbb")
+
+	body, etag, ok := readCache(t, c, "ns/1/a")
+	assert.True(t, ok)
+	assert.Equal(t, "aaaa", body)
+	assert.Equal(t, `"a"`, etag)
+	assert.Equal(t, int64(8), c.Size())
+
+	// b is the least recently used one
+	putCache(t, c, "ns/1/c", "", "cccc")
+	_, _, ok = readCache(t, c, "ns/1/b")
+	assert.False(t, ok)
+	assert.Equal(t, int64(8), c.Size())
+
+	w, err := c.Put("ns/1/d", nil)
+	if assert.NoError(t, err) {
+		w.Write([]byte("dd"))
+		assert.NoError(t, w.Abort())
+	}
+	_, _, ok = readCache(t, c, "ns/1/d")
+	assert.False(t, ok)
+
+	c.Remove("ns/1/c")
+	_, _, ok = readCache(t, c, "ns/1/c")
+	assert.False(t, ok)
+
+	// entries survive a restart
+	c, err = NewFSCache(dir, 10)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	body, etag, ok = readCache(t, c, "ns/1/a")
+	assert.True(t, ok)
+	assert.Equal(t, "aaaa", body)
+	assert.Equal(t, `"a"`, etag)
+	assert.Equal(t, int64(4), c.Size())
+}
+
+func TestFSCacheSharedDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"important.txt", "notes.tmp", "notes.header"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("data"), 0644))
+	}
+
+	c, err := NewFSCache(dir, 10)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	putCache(t, c, "ns/1/a", "", "aaaa")
+	putCache(t, c, "ns/1/b", "", "bbbb")
+	// a body being stored by a crashed run
+	_, err = c.Put("ns/1/c", nil)
+	assert.NoError(t, err)
+
+	// the limit is lowered on restart
+	c, err = NewFSCache(dir, 5)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, int64(4), c.Size())
+	_, _, ok := readCache(t, c, "ns/1/b")
+	assert.True(t, ok)
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	sort.Strings(names)
+	name := c.fileName("ns/1/b")
+	assert.Equal(t, []string{
+		name, name + fsCacheHeaderSuffix,
+		"important.txt", "notes.header", "notes.tmp",
+	}, names)
+}
+
+func TestGetReadThroughCache(t *testing.T) {
+	const etag = `"v1"`
+	var full, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader("TESTBLOB"))
+	}))
+	defer srv.Close()
+
+	c, err := NewFSCache(t.TempDir(), 1<<20)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cli := newTestClient(t, srv)
+	cli.Cache = c
+	ctx := context.Background()
+
+	// a partially read body is not cached
+	rd, err := cli.Get(ctx, "ns", "1/key")
+	if assert.NoError(t, err) {
+		rd.Read(make([]byte, 2))
+		rd.Close()
+	}
+	_, ok := c.Get(cacheKey("ns", "1/key"))
+	assert.False(t, ok)
+
+	for i := 0; i < 3; i++ {
+		body, err := cli.GetFile(ctx, "ns", "1/key")
+		assert.NoError(t, err)
+		assert.Equal(t, "TESTBLOB", string(body))
+	}
+	assert.Equal(t, 2, full)
+	assert.Equal(t, 2, notModified)
+
+	// ranged reads bypass the cache
+	body, err := cli.GetFile(ctx, "ns", "1/key", 2, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, "STB", string(body))
+	assert.Equal(t, 3, full)
+}
+
+func TestGetReadThroughCacheWithoutETag(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("TESTBLOB"))
+	}))
+	defer srv.Close()
+
+	c, err := NewFSCache(t.TempDir(), 1<<20)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cli := newTestClient(t, srv)
+	cli.Cache = c
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		body, err := cli.GetFile(ctx, "ns", "1/key")
+		assert.NoError(t, err)
+		assert.Equal(t, "TESTBLOB", string(body))
+	}
+	assert.Equal(t, 1, requests)
+}
+
+func TestInvalidateCache(t *testing.T) {
+	var version = "v1"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(version))
+	}))
+	defer srv.Close()
+
+	c, err := NewFSCache(t.TempDir(), 1<<20)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cli := newTestClient(t, srv)
+	cli.Cache = c
+	ctx := context.Background()
+
+	read := func(key string) string {
+		body, err := cli.GetFile(ctx, "ns", key)
+		assert.NoError(t, err)
+		return string(body)
+	}
+
+	assert.Equal(t, "v1", read("1/a"))
+	assert.Equal(t, "v1", read("1/b"))
+	version = "v2"
+	assert.Equal(t, "v1", read("1/a"))
+
+	cli.InvalidateCache("ns", "1/a")
+	assert.Equal(t, "v2", read("1/a"))
+	assert.Equal(t, "v1", read("1/b"))
+
+	// a body being read while the cache is flushed is not committed
+	rd, err := cli.Get(ctx, "ns", "1/c")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.NoError(t, cli.FlushCaches())
+	ioutil.ReadAll(rd)
+	rd.Close()
+
+	assert.Equal(t, int64(0), c.Size())
+	version = "v3"
+	assert.Equal(t, "v3", read("1/a"))
+	assert.Equal(t, "v3", read("1/b"))
+	assert.Equal(t, "v3", read("1/c"))
+
+	cli.Cache = nil
+	cli.InvalidateCache("ns", "1/a")
+	assert.NoError(t, cli.FlushCaches())
+}
+
+func TestCacheBypassedWithAuthOverride(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "OAuth alice" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("alice-secret"))
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	cli.Cache = NewMemCache(1 << 20)
+	ctx := context.Background()
+
+	body, err := cli.GetFile(WithAuthHeader(ctx, "OAuth alice"), "ns", "1/k")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice-secret", string(body))
+
+	_, err = cli.GetFile(WithAuthHeader(ctx, "OAuth mallory"), "ns", "1/k")
+	assert.True(t, errors.Is(err, ErrForbidden), "%v", err)
+	assert.Equal(t, 2, requests)
+	_, ok := cli.Cache.Get(cacheKey("ns", "1/k"))
+	assert.False(t, ok)
+}
+
+func TestDeleteInvalidatesCache(t *testing.T) {
+	deleted := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/delete-ns/"):
+			deleted = true
+		case deleted:
+			http.NotFound(w, r)
+		default:
+			w.Write([]byte("TESTBLOB"))
+		}
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	cli.Cache = NewMemCache(1 << 20)
+	ctx := context.Background()
+
+	body, err := cli.GetFile(ctx, "ns", "1/key")
+	assert.NoError(t, err)
+	assert.Equal(t, "TESTBLOB", string(body))
+
+	assert.NoError(t, cli.Delete(ctx, "ns", "1/key"))
+	_, err = cli.GetFile(ctx, "ns", "1/key")
+	assert.True(t, errors.Is(err, ErrKeyNotFound), "%v", err)
+}
+
+func TestUploadInvalidatesCache(t *testing.T) {
+	srv := newStoreServer()
+	defer srv.Close()
+
+	cli := newTestClient(t, srv.Server)
+	cli.Cache = NewMemCache(1 << 20)
+	ctx := context.Background()
+
+	for _, blob := range []string{"TESTBLOB", "NEWBLOB"} {
+		info, err := cli.Upload(ctx, "ns", "file", int64(len(blob)), strings.NewReader(blob))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		// the store replies without ETag, so the entry isn't revalidated
+		body, err := cli.GetFile(ctx, "ns", info.Key)
+		assert.NoError(t, err)
+		assert.Equal(t, blob, string(body))
+	}
+}
+
+func TestCacheKeepsHeaders(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Write([]byte("TESTBLOB"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	c, err := NewFSCache(dir, 1<<20)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cli := newTestClient(t, srv)
+	cli.Cache = c
+	ctx := context.Background()
+
+	open := func() ObjectInfo {
+		obj, err := cli.OpenObject(ctx, "ns", "1/key")
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		defer obj.Body.Close()
+		body, err := ioutil.ReadAll(obj.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "TESTBLOB", string(body))
+		return obj.ObjectInfo
+	}
+
+	miss := open()
+	assert.Equal(t, "max-age=60", miss.CacheControl)
+	assert.Equal(t, miss, open())
+
+	// metadata survives a restart
+	cli.Cache, err = NewFSCache(dir, 1<<20)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, miss, open())
+	assert.Equal(t, 1, requests)
+}
@@ -0,0 +1,48 @@
+package mds
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Clock tells time to retries, circuit breakers and WaitDeleted.
+// The real time is used unless WithClock replaces it, e.g. in tests.
+type Clock interface {
+	Now() time.Time
+	// Sleep waits for d, it returns ctx.Err() if ctx is done earlier.
+	Sleep(ctx context.Context, d time.Duration) error
+	// After sends the current time on the returned channel after d.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is Clock of the time package
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// setClock makes the client and its circuit breakers tell time by c
+func (m *Client) setClock(c Clock) {
+	m.clock = c
+	if m.breakers != nil {
+		m.breakers.clock = c
+	}
+}
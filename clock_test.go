@@ -0,0 +1,91 @@
+package mds
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// fakeClock moves only when it's waited for or advanced,
+// it records every wait
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.wait(d)
+	return nil
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- c.wait(d)
+	return ch
+}
+
+func (c *fakeClock) wait(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Waits returns waits recorded since the previous call
+func (c *fakeClock) Waits() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	waits := c.waits
+	c.waits = nil
+	return waits
+}
+
+func TestRealClock(t *testing.T) {
+	var c realClock
+	assert.NoError(t, c.Sleep(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, c.Sleep(ctx, time.Hour))
+
+	start := c.Now()
+	<-c.After(time.Millisecond)
+	assert.True(t, c.Now().Sub(start) >= time.Millisecond)
+}
+
+func TestWithClock(t *testing.T) {
+	clk := newFakeClock()
+	cli, err := New("127.0.0.1",
+		WithPorts(1111, 80),
+		WithConfig(func(c *Config) { c.Breaker = BreakerPolicy{Threshold: 1} }),
+		WithClock(clk),
+	)
+	if assert.NoError(t, err) {
+		assert.Equal(t, clk, cli.clock)
+		assert.Equal(t, clk, cli.breakers.clock)
+	}
+}
@@ -0,0 +1,56 @@
+package mds
+
+import (
+	"fmt"
+
+	"golang.org/x/net/context"
+)
+
+// Copy streams srcKey of srcNamespace into an upload of filename to dstNamespace,
+// the object is never buffered as a whole. The proxy assigns a new key,
+// it's returned in UploadInfo. Options tune the upload.
+func (m *Client) Copy(ctx context.Context, srcNamespace, srcKey, dstNamespace, filename string, opts ...UploadOption) (*UploadInfo, error) {
+	info, _, err := m.copyObject(ctx, srcNamespace, srcKey, dstNamespace, filename, opts...)
+	return info, err
+}
+
+// copyObject is Copy also returning a size of the source or -1 if it's unknown
+func (m *Client) copyObject(ctx context.Context, srcNamespace, srcKey, dstNamespace, filename string, opts ...UploadOption) (*UploadInfo, int64, error) {
+	resp, err := m.get(ctx, srcNamespace, srcKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	// an unknown length makes the upload chunked
+	info, err := m.Upload(ctx, dstNamespace, filename, resp.ContentLength, resp.Body, opts...)
+	return info, resp.ContentLength, err
+}
+
+// Move copies key to filename within namespace, checks that the new object
+// is readable and has the size of the old one, and only then deletes key.
+// The proxy assigns a new key, it's returned in UploadInfo.
+// If the copy is done, but the check or the delete fails, UploadInfo is returned
+// along with the error, so the caller could remove either object.
+func (m *Client) Move(ctx context.Context, namespace, key, filename string, opts ...UploadOption) (*UploadInfo, error) {
+	info, size, err := m.copyObject(ctx, namespace, key, namespace, filename, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	moved, err := m.Stat(ctx, namespace, info.Key)
+	if err != nil {
+		return info, fmt.Errorf("unable to check moved object %s: %w", info.Key, err)
+	}
+	if size < 0 {
+		size = int64(info.Size)
+	}
+	if moved.Size != size {
+		return info, fmt.Errorf("moved object %s has size %d instead of %d", info.Key, moved.Size, size)
+	}
+
+	if err := m.Delete(ctx, namespace, key); err != nil {
+		return info, err
+	}
+	return info, nil
+}
@@ -0,0 +1,88 @@
+package mds
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestCopy(t *testing.T) {
+	var uploaded string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/get-staging/1/key":
+			w.Write([]byte("TESTBLOB"))
+		case strings.HasPrefix(r.URL.Path, "/upload-production/"):
+			body, _ := ioutil.ReadAll(r.Body)
+			uploaded = string(body)
+			fmt.Fprintf(w, `<post obj="production.file" id="0:1" groups="2" size="%d" key="2/file"><written>2</written></post>`, len(body))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	info, err := cli.Copy(ctx, "staging", "1/key", "production", "file")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "2/file", info.Key)
+		assert.Equal(t, uint64(8), info.Size)
+	}
+	assert.Equal(t, "TESTBLOB", uploaded)
+
+	_, err = cli.Copy(ctx, "staging", "1/missing", "production", "file")
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+}
+
+func TestMove(t *testing.T) {
+	var deleted []string
+	movedSize := "8"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/get-ns/1/key":
+			w.Write([]byte("TESTBLOB"))
+		case r.URL.Path == "/get-ns/2/file":
+			w.Header().Set("Content-Length", movedSize)
+		case strings.HasPrefix(r.URL.Path, "/upload-ns/"):
+			body, _ := ioutil.ReadAll(r.Body)
+			fmt.Fprintf(w, `<post obj="ns.file" id="0:1" groups="2" size="%d" key="2/file"><written>2</written></post>`, len(body))
+		case strings.HasPrefix(r.URL.Path, "/delete-ns/"):
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/delete-ns/"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	info, err := cli.Move(ctx, "ns", "1/key", "file")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "2/file", info.Key)
+	}
+	assert.Equal(t, []string{"1/key"}, deleted)
+
+	// the old key is kept if the new object doesn't match
+	deleted = nil
+	movedSize = "4"
+	info, err = cli.Move(ctx, "ns", "1/key", "file")
+	assert.Error(t, err)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, "2/file", info.Key)
+	}
+	assert.Empty(t, deleted)
+
+	_, err = cli.Move(ctx, "ns", "1/missing", "file")
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+	assert.Empty(t, deleted)
+}
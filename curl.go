@@ -0,0 +1,60 @@
+package mds
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const maskedCredentials = "<masked>"
+
+// CurlCommand renders req as a curl command for debugging, e.g. from a logging RoundTripper.
+// Credentials of Authorization header are masked unless unsafe is true.
+// A body is never rendered: curl is told to read it from stdin instead.
+func CurlCommand(req *http.Request, unsafe bool) string {
+	args := []string{"curl", "-X", req.Method}
+	if req.Method == "HEAD" {
+		// -X HEAD makes curl wait for a body which never comes
+		args = []string{"curl", "-I"}
+	}
+
+	header := req.Header.Clone()
+	if req.Host != "" && req.Host != req.URL.Host {
+		header.Set("Host", req.Host)
+	}
+	if !unsafe {
+		for i, value := range header.Values("Authorization") {
+			header["Authorization"][i] = maskAuthorization(value)
+		}
+	}
+
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			args = append(args, "-H", shellQuote(name+": "+value))
+		}
+	}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		args = append(args, "--data-binary", "@-")
+	}
+
+	args = append(args, shellQuote(req.URL.String()))
+	return strings.Join(args, " ")
+}
+
+// maskAuthorization keeps a scheme, but hides credentials
+func maskAuthorization(value string) string {
+	if i := strings.IndexByte(value, ' '); i > 0 {
+		return value[:i+1] + maskedCredentials
+	}
+	return maskedCredentials
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
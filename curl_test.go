@@ -0,0 +1,51 @@
+package mds
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestCurlCommand(t *testing.T) {
+	cli, err := NewClient(Config{
+		Host:       "proxy.net",
+		UploadPort: 1111,
+		ReadPort:   80,
+		AuthHeader: "Basic dGVzdDp0ZXN0",
+	}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	ctx := context.Background()
+	req, err := cli.newRequest(ctx, "GET", cli.readURL(ctx, "ns", "1/key"), nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	req.Header.Set("Range", "bytes=2-4")
+	req.Header.Set("X-Note", "it's")
+
+	assert.Equal(t,
+		`curl -X GET -H 'Authorization: Basic <masked>' -H 'Range: bytes=2-4' -H 'X-Note: it'\''s' 'http://proxy.net:80/get-ns/1/key'`,
+		CurlCommand(req, false))
+	assert.Equal(t,
+		`curl -X GET -H 'Authorization: Basic dGVzdDp0ZXN0' -H 'Range: bytes=2-4' -H 'X-Note: it'\''s' 'http://proxy.net:80/get-ns/1/key'`,
+		CurlCommand(req, true))
+	// rendering doesn't touch the request
+	assert.Equal(t, "Basic dGVzdDp0ZXN0", req.Header.Get("Authorization"))
+
+	req, err = http.NewRequest("POST", cli.uploadURL(ctx, "ns", "file"), strings.NewReader("TEST"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, `curl -X POST --data-binary @- 'http://proxy.net:1111/upload-ns/file'`, CurlCommand(req, false))
+
+	req, err = http.NewRequest("HEAD", cli.readURL(ctx, "ns", "1/key"), nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, `curl -I 'http://proxy.net:80/get-ns/1/key'`, CurlCommand(req, false))
+}
@@ -0,0 +1,69 @@
+package mds
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Environment variables read by ConfigFromEnv
+const (
+	EnvHost       = "MDS_HOST"
+	EnvUploadPort = "MDS_UPLOAD_PORT"
+	EnvReadPort   = "MDS_READ_PORT"
+	EnvAuth       = "MDS_AUTH"
+	EnvScheme     = "MDS_SCHEME"
+)
+
+// ConfigFromEnv builds Config from environment variables.
+// MDS_HOST, MDS_UPLOAD_PORT and MDS_READ_PORT are required.
+// MDS_AUTH is a complete value of Authorization header.
+// MDS_SCHEME is either http or https, http is used by default.
+func ConfigFromEnv() (Config, error) {
+	var cfg Config
+
+	host := os.Getenv(EnvHost)
+	if host == "" {
+		return cfg, fmt.Errorf("%s is not set", EnvHost)
+	}
+
+	uploadPort, err := portFromEnv(EnvUploadPort)
+	if err != nil {
+		return cfg, err
+	}
+
+	readPort, err := portFromEnv(EnvReadPort)
+	if err != nil {
+		return cfg, err
+	}
+
+	if scheme := os.Getenv(EnvScheme); scheme != "" {
+		if scheme != "http" && scheme != "https" {
+			return cfg, fmt.Errorf("invalid %s %q: must be http or https", EnvScheme, scheme)
+		}
+		if strings.Contains(host, "://") {
+			return cfg, fmt.Errorf("%s %q already has a scheme, but %s is set", EnvHost, host, EnvScheme)
+		}
+		host = scheme + "://" + host
+	}
+
+	cfg.Host = host
+	cfg.UploadPort = uploadPort
+	cfg.ReadPort = readPort
+	cfg.AuthHeader = os.Getenv(EnvAuth)
+	return cfg, nil
+}
+
+func portFromEnv(name string) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, fmt.Errorf("%s is not set", name)
+	}
+
+	port, err := strconv.Atoi(value)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, fmt.Errorf("invalid %s %q: must be a port number", name, value)
+	}
+	return port, nil
+}
@@ -0,0 +1,59 @@
+package mds
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv(EnvHost, "proxy.net")
+	t.Setenv(EnvUploadPort, "1111")
+	t.Setenv(EnvReadPort, "80")
+	t.Setenv(EnvAuth, "Basic dGVzdDp0ZXN0")
+	t.Setenv(EnvScheme, "https")
+
+	cfg, err := ConfigFromEnv()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, Config{
+		Host:       "https://proxy.net",
+		UploadPort: 1111,
+		ReadPort:   80,
+		AuthHeader: "Basic dGVzdDp0ZXN0",
+	}, cfg)
+
+	t.Setenv(EnvScheme, "")
+	cfg, err = ConfigFromEnv()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "proxy.net", cfg.Host)
+	}
+}
+
+func TestConfigFromEnvInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name, value string
+	}{
+		{EnvHost, ""},
+		{EnvUploadPort, ""},
+		{EnvUploadPort, "port"},
+		{EnvReadPort, "0"},
+		{EnvReadPort, "65536"},
+		{EnvScheme, "ftp"},
+	} {
+		t.Setenv(EnvHost, "proxy.net")
+		t.Setenv(EnvUploadPort, "1111")
+		t.Setenv(EnvReadPort, "80")
+		t.Setenv(EnvScheme, "")
+		t.Setenv(tc.name, tc.value)
+
+		_, err := ConfigFromEnv()
+		assert.Error(t, err, "%s=%q", tc.name, tc.value)
+	}
+
+	t.Setenv(EnvHost, "http://proxy.net")
+	t.Setenv(EnvScheme, "https")
+	_, err := ConfigFromEnv()
+	assert.Error(t, err)
+}
@@ -2,36 +2,98 @@ package mds
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"strings"
+	"syscall"
 )
 
 // TODO: there are lots of memory allocations
 
+// ErrUnauthorized means that a proxy rejected credentials, e.g. AuthHeader is wrong or expired
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrPayloadTooLarge means that an uploaded object exceeds a limit of a proxy
+var ErrPayloadTooLarge = errors.New("payload too large")
+
+// ErrKeyNotFound means that there is no object stored under a key
+var ErrKeyNotFound = errors.New("key not found")
+
+// ErrForbidden means that credentials don't grant access to a namespace or an operation
+var ErrForbidden = errors.New("forbidden")
+
+// ErrTooManyRequests means that a proxy throttles requests
+var ErrTooManyRequests = errors.New("too many requests")
+
+// ErrUnavailable means that a proxy is temporarily unable to serve requests
+var ErrUnavailable = errors.New("service unavailable")
+
+// ErrNoSpace means that storage has no space left for an upload
+var ErrNoSpace = errors.New("no space left")
+
+// ErrNoKey means that the proxy accepted an upload, but didn't report a key of the object
+var ErrNoKey = errors.New("no key reported")
+
+// ErrStillPending means that a deleted key is still readable, see WaitDeleted
+var ErrStillPending = errors.New("delete is still pending")
+
+// statusError maps a status code to a sentinel error
+func statusError(code int) error {
+	switch code {
+	case http.StatusNotFound:
+		return ErrKeyNotFound
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusRequestEntityTooLarge:
+		return ErrPayloadTooLarge
+	case http.StatusTooManyRequests:
+		return ErrTooManyRequests
+	case http.StatusServiceUnavailable:
+		return ErrUnavailable
+	case http.StatusInsufficientStorage:
+		return ErrNoSpace
+	default:
+		return nil
+	}
+}
+
 // ErrorMethodScope is a scope of a failed operation
 type ErrorMethodScope struct {
 	Method string
 	URL    string
+	// Namespace and Key are empty for operations not bound to an object, like ping.
+	// Key is a filename for upload, since a key is assigned by the proxy.
+	Namespace string
+	Key       string
 }
 
 // ErrorResponseScope contains information about a http reply
 type ErrorResponseScope struct {
-	Status string
-	Body   []byte
+	Status     string
+	StatusCode int
+	Body       []byte
 }
 
 func (err ErrorResponseScope) String() string {
 	return fmt.Sprintf("%s %s", err.Status, err.Body)
 }
 
+// snippetSize limits how much of a body is kept in errors
+const snippetSize = 512
+
 func newResponseScope(resp *http.Response) ErrorResponseScope {
 	var buff = new(bytes.Buffer)
 	// we really do not care about any error here
-	io.CopyN(buff, resp.Body, 512)
+	io.CopyN(buff, resp.Body, snippetSize)
 	return ErrorResponseScope{
-		Status: resp.Status,
-		Body:   buff.Bytes(),
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+		Body:       buff.Bytes(),
 	}
 }
 
@@ -45,6 +107,12 @@ func (err MethodError) Error() string {
 	return fmt.Sprintf("%s failed on %s: %s", err.Method, err.URL, err.ErrorResponseScope.String())
 }
 
+// Unwrap allows to match the error with errors like ErrUnauthorized
+// according to the status code of a reply.
+func (err MethodError) Unwrap() error {
+	return statusError(err.StatusCode)
+}
+
 func newMethodError(scope ErrorMethodScope, resp *http.Response) error {
 	err := MethodError{
 		ErrorMethodScope:   scope,
@@ -52,3 +120,140 @@ func newMethodError(scope ErrorMethodScope, resp *http.Response) error {
 	}
 	return err
 }
+
+// ErrUnexpectedContentType is matched by ContentTypeError with errors.Is
+var ErrUnexpectedContentType = errors.New("unexpected content type")
+
+// ContentTypeError is returned when a proxy replies with something else than XML,
+// e.g. an HTML error page of a gateway with 200 status.
+type ContentTypeError struct {
+	ContentType string
+	Body        []byte
+}
+
+func (err ContentTypeError) Error() string {
+	return fmt.Sprintf("%v %q: %s", ErrUnexpectedContentType, err.ContentType, err.Body)
+}
+
+// Unwrap allows to match the error with ErrUnexpectedContentType
+func (err ContentTypeError) Unwrap() error {
+	return ErrUnexpectedContentType
+}
+
+func checkNotHTML(resp *http.Response, head []byte) error {
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	if len(head) > snippetSize {
+		head = head[:snippetSize]
+	}
+	trimmed := bytes.ToLower(bytes.TrimSpace(head))
+	if mediaType == "text/html" || bytes.HasPrefix(trimmed, []byte("<!doctype")) || bytes.HasPrefix(trimmed, []byte("<html")) {
+		return ContentTypeError{
+			ContentType: contentType,
+			Body:        append([]byte(nil), head...),
+		}
+	}
+	return nil
+}
+
+// ErrEncodedRange means that a proxy returned a range of compressed content.
+// Such a range can't be decoded on its own, so the object must be read as a whole.
+var ErrEncodedRange = errors.New("range of encoded content")
+
+// checkRangeEncoding rejects a partial reply with Content-Encoding,
+// which would otherwise be returned as undecodable bytes.
+func checkRangeEncoding(resp *http.Response) error {
+	encoding := resp.Header.Get("Content-Encoding")
+	if encoding == "" || strings.EqualFold(encoding, "identity") {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %s", ErrEncodedRange, encoding, resp.Header.Get("Content-Range"))
+}
+
+// ErrConnectionReset is matched by ConnectionResetError with errors.Is
+var ErrConnectionReset = errors.New("connection reset")
+
+// ConnectionResetError is returned by a body of a read when a connection
+// breaks before the body is complete, so the read could be retried or resumed
+// from the current offset. It's distinct from io.EOF at the real end of a body.
+type ConnectionResetError struct {
+	Err error
+}
+
+func (err ConnectionResetError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrConnectionReset, err.Err)
+}
+
+// Is allows to match the error with ErrConnectionReset
+func (err ConnectionResetError) Is(target error) bool {
+	return target == ErrConnectionReset
+}
+
+// Unwrap returns the original read error
+func (err ConnectionResetError) Unwrap() error {
+	return err.Err
+}
+
+// resetClassifyingBody wraps errors of a broken connection into ConnectionResetError
+type resetClassifyingBody struct {
+	io.ReadCloser
+}
+
+func (b *resetClassifyingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		err = ConnectionResetError{Err: err}
+	}
+	return n, err
+}
+
+// ErrSignatureInvalid means that DownloadInfo doesn't carry a well-formed signature
+var ErrSignatureInvalid = errors.New("invalid signature")
+
+// ErrSignatureExpired means that a direct link of DownloadInfo is no longer valid
+var ErrSignatureExpired = errors.New("signature expired")
+
+// ErrSizeMismatch is matched by SizeMismatchError with errors.Is
+var ErrSizeMismatch = errors.New("size mismatch")
+
+// SizeMismatchError is returned by Upload when a body turns out to be
+// shorter or longer than the declared size.
+// If the body is longer, Observed is the number of bytes read
+// before the mismatch was detected, not the real length.
+type SizeMismatchError struct {
+	Declared int64
+	Observed int64
+}
+
+func (err SizeMismatchError) Error() string {
+	return fmt.Sprintf("%v: declared %d bytes, read %d", ErrSizeMismatch, err.Declared, err.Observed)
+}
+
+// Unwrap allows to match the error with ErrSizeMismatch
+func (err SizeMismatchError) Unwrap() error {
+	return ErrSizeMismatch
+}
+
+// ErrObjectChanged means that an object was overwritten while it was read in parts
+var ErrObjectChanged = errors.New("object changed")
+
+// ObjectChangedError is returned by GetParallel if a chunk doesn't belong
+// to the version of the object it started with.
+// It matches ErrObjectChanged with errors.Is.
+type ObjectChangedError struct {
+	Key string
+	// Size is a size of the object seen at the start, Observed is one reported with the chunk
+	// or -1 if it's unknown.
+	Size     int64
+	Observed int64
+}
+
+func (err ObjectChangedError) Error() string {
+	return fmt.Sprintf("%v: %s had %d bytes, now %d", ErrObjectChanged, err.Key, err.Size, err.Observed)
+}
+
+// Unwrap allows to match the error with ErrObjectChanged
+func (err ObjectChangedError) Unwrap() error {
+	return ErrObjectChanged
+}
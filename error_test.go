@@ -0,0 +1,175 @@
+package mds
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+const htmlPage = `<!DOCTYPE html>
+<html><head><title>502 Bad Gateway</title></head><body>Bad Gateway</body></html>`
+
+func TestUnexpectedContentType(t *testing.T) {
+	var contentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		io.WriteString(w, htmlPage)
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	for _, contentType = range []string{"text/html; charset=utf-8", "text/xml"} {
+		_, err := cli.Upload(ctx, "ns", "key", 4, bytes.NewReader([]byte("TEST")))
+		assert.True(t, errors.Is(err, ErrUnexpectedContentType), "upload: %v", err)
+
+		_, err = cli.DownloadInfo(ctx, "ns", "1/key")
+		assert.True(t, errors.Is(err, ErrUnexpectedContentType), "downloadinfo: %v", err)
+
+		var ctErr ContentTypeError
+		if assert.True(t, errors.As(err, &ctErr)) {
+			assert.Equal(t, contentType, ctErr.ContentType)
+			assert.Equal(t, htmlPage, string(ctErr.Body))
+		}
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad token", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	_, err := cli.Get(ctx, "ns", "1/key")
+	assert.True(t, errors.Is(err, ErrUnauthorized), "get: %v", err)
+
+	_, err = cli.Upload(ctx, "ns", "key", 4, bytes.NewReader([]byte("TEST")))
+	assert.True(t, errors.Is(err, ErrUnauthorized), "upload: %v", err)
+
+	err = cli.Delete(ctx, "ns", "1/key")
+	assert.True(t, errors.Is(err, ErrUnauthorized), "delete: %v", err)
+
+	_, err = cli.ReadURL(ctx, "ns", "1/key", true)
+	assert.True(t, errors.Is(err, ErrUnauthorized), "readURL: %v", err)
+
+	mErr, ok := err.(MethodError)
+	if assert.True(t, ok) {
+		assert.Equal(t, http.StatusUnauthorized, mErr.StatusCode)
+	}
+}
+
+func TestStatusSentinels(t *testing.T) {
+	var status int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	for code, sentinel := range map[int]error{
+		http.StatusNotFound:            ErrKeyNotFound,
+		http.StatusUnauthorized:        ErrUnauthorized,
+		http.StatusForbidden:           ErrForbidden,
+		http.StatusTooManyRequests:     ErrTooManyRequests,
+		http.StatusServiceUnavailable:  ErrUnavailable,
+		http.StatusInsufficientStorage: ErrNoSpace,
+	} {
+		status = code
+		err := cli.Ping(context.Background())
+		assert.True(t, errors.Is(err, sentinel), "%d: %v", code, err)
+
+		var mErr MethodError
+		if assert.True(t, errors.As(err, &mErr)) {
+			assert.Equal(t, code, mErr.StatusCode)
+		}
+	}
+}
+
+func TestMethodErrorScope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such key", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	var mErr MethodError
+	_, err := cli.Get(ctx, "ns", "1/key")
+	if assert.True(t, errors.As(err, &mErr)) {
+		assert.Equal(t, "get", mErr.Method)
+		assert.Equal(t, "ns", mErr.Namespace)
+		assert.Equal(t, "1/key", mErr.Key)
+		assert.Equal(t, http.StatusNotFound, mErr.StatusCode)
+		assert.Equal(t, "no such key\n", string(mErr.Body))
+	}
+
+	err = cli.Delete(ctx, "ns", "1/key")
+	if assert.True(t, errors.As(err, &mErr)) {
+		assert.Equal(t, "delete", mErr.Method)
+		assert.Equal(t, "1/key", mErr.Key)
+	}
+
+	_, err = cli.Upload(ctx, "ns", "file", 4, bytes.NewReader([]byte("TEST")))
+	if assert.True(t, errors.As(err, &mErr)) {
+		assert.Equal(t, "upload", mErr.Method)
+		assert.Equal(t, "file", mErr.Key)
+	}
+
+	err = cli.Ping(ctx)
+	if assert.True(t, errors.As(err, &mErr)) {
+		assert.Empty(t, mErr.Namespace)
+		assert.Empty(t, mErr.Key)
+	}
+}
+
+func TestMethodErrorWithoutSentinel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer srv.Close()
+
+	err := newTestClient(t, srv).Ping(context.Background())
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrUnauthorized))
+	assert.Nil(t, errors.Unwrap(err))
+}
+
+func TestConnectionResetError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\nTESTBLOB")
+		buf.Flush()
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	rd, err := cli.Get(context.Background(), "ns", "1/key")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer rd.Close()
+
+	body, err := ioutil.ReadAll(rd)
+	assert.Equal(t, "TESTBLOB", string(body))
+	assert.True(t, errors.Is(err, ErrConnectionReset))
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+
+	_, err = cli.GetFile(context.Background(), "ns", "1/key")
+	assert.True(t, errors.Is(err, ErrConnectionReset))
+}
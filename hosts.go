@@ -0,0 +1,124 @@
+package mds
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+)
+
+// hostPool rotates requests across Config.Hosts
+type hostPool struct {
+	hosts []string
+	// byName maps a hostname to an index in hosts
+	byName map[string]int
+	next   uint32
+}
+
+func newHostPool(hosts []string, useTLS bool) (*hostPool, error) {
+	p := &hostPool{byName: make(map[string]int, len(hosts))}
+	for _, host := range hosts {
+		if err := checkScheme(host, useTLS); err != nil {
+			return nil, err
+		}
+		host = withScheme(host, useTLS)
+		u, err := url.Parse(host)
+		if err != nil || u.Hostname() == "" || u.Port() != "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("invalid host %q in Hosts", host)
+		}
+		if _, ok := p.byName[u.Hostname()]; ok {
+			return nil, fmt.Errorf("duplicate host %q in Hosts", host)
+		}
+		p.byName[u.Hostname()] = len(p.hosts)
+		p.hosts = append(p.hosts, host)
+	}
+	return p, nil
+}
+
+// pick returns a host for the next request
+func (p *hostPool) pick() string {
+	n := atomic.AddUint32(&p.next, 1) - 1
+	return p.hosts[n%uint32(len(p.hosts))]
+}
+
+// failoverTransport resends a request to the next host of a pool
+// if a connection to a host can't be established.
+type failoverTransport struct {
+	next http.RoundTripper
+	pool *hostPool
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	first, ok := t.pool.byName[req.URL.Hostname()]
+	// a body can be sent again only if it can be recreated
+	if !ok || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return t.next.RoundTrip(req)
+	}
+
+	for i := 0; ; i++ {
+		resp, err := t.next.RoundTrip(req)
+		if err == nil || i == len(t.pool.hosts)-1 || req.Context().Err() != nil || !failoverable(err) {
+			return resp, err
+		}
+
+		host, _ := url.Parse(t.pool.hosts[(first+i+1)%len(t.pool.hosts)])
+		if req, err = t.redirect(req, host); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// redirect returns a copy of req sent to host
+func (t *failoverTransport) redirect(req *http.Request, host *url.URL) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	clone.URL.Scheme = host.Scheme
+	if port := req.URL.Port(); port != "" {
+		clone.URL.Host = net.JoinHostPort(host.Hostname(), port)
+	} else {
+		clone.URL.Host = host.Host
+	}
+	if clone.Host == req.URL.Host {
+		clone.Host = ""
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		clone.Body = body
+	}
+	return clone, nil
+}
+
+// CloseIdleConnections lets http.Client reach the wrapped transport
+func (t *failoverTransport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// failoverable reports whether err means a request hasn't reached a host
+func failoverable(err error) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// withFailover returns a copy of client failing over across hosts of pool
+func withFailover(client *http.Client, pool *hostPool) *http.Client {
+	if pool == nil || len(pool.hosts) < 2 {
+		return client
+	}
+	transport := client.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	fclient := *client
+	fclient.Transport = &failoverTransport{next: transport, pool: pool}
+	return &fclient
+}
@@ -0,0 +1,118 @@
+package mds
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestHostsFailover(t *testing.T) {
+	var mu sync.Mutex
+	var served []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		served = append(served, strings.Split(r.Host, ":")[0])
+		mu.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/upload-") {
+			body := make([]byte, 4)
+			if n, _ := r.Body.Read(body); string(body[:n]) != "TEST" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(uploadReply))
+		}
+	}))
+	defer srv.Close()
+
+	// nothing listens on a port of a closed listener
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	down.Close()
+
+	var dialer net.Dialer
+	port := serverPort(t, srv)
+	cli, err := New("unused.invalid",
+		WithPorts(port, port),
+		WithHosts("a.invalid", "b.invalid", "http://c.invalid"),
+		WithConfig(func(c *Config) {
+			c.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if strings.HasPrefix(addr, "b.invalid:") {
+					return dialer.DialContext(ctx, network, down.Addr().String())
+				}
+				return dialer.DialContext(ctx, network, srv.Listener.Addr().String())
+			}
+		}),
+	)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, cli.Ping(ctx))
+	}
+	assert.Equal(t, []string{"a.invalid", "c.invalid", "c.invalid"}, served)
+
+	// b.invalid is next, the body is resent to c.invalid
+	served = nil
+	for i := 0; i < 2; i++ {
+		_, err = cli.Upload(ctx, "ns", "file", 4, bytes.NewReader([]byte("TEST")))
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"a.invalid", "c.invalid"}, served)
+
+	// a body which can't be recreated is not resent
+	served = nil
+	assert.NoError(t, cli.Ping(ctx))
+	assert.NoError(t, cli.Ping(ctx))
+	_, err = cli.Upload(ctx, "ns", "file", 4, opaqueReader{bytes.NewReader([]byte("TEST"))})
+	var opErr *net.OpError
+	assert.True(t, errors.As(err, &opErr), "%v", err)
+	assert.Equal(t, []string{"c.invalid", "a.invalid"}, served)
+
+	// a checksummed body is resent as well
+	served = nil
+	assert.NoError(t, cli.Ping(ctx))
+	assert.NoError(t, cli.Ping(ctx))
+	h := sha256.New()
+	_, err = cli.Upload(ctx, "ns", "file", 4, bytes.NewReader([]byte("TEST")), WithChecksum(h))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c.invalid", "a.invalid", "c.invalid"}, served)
+	sum := sha256.Sum256([]byte("TEST"))
+	assert.Equal(t, sum[:], h.Sum(nil))
+
+	// an endpoint override is not rotated
+	served = nil
+	assert.NoError(t, cli.Ping(WithEndpoint(ctx, "d.invalid", 0)))
+	assert.Equal(t, []string{"d.invalid"}, served)
+}
+
+func TestHostsValidation(t *testing.T) {
+	for _, hosts := range [][]string{
+		{"a.invalid", "a.invalid"},
+		{"a.invalid:80"},
+		{"http://a.invalid/path"},
+		{""},
+	} {
+		_, err := New("", WithHosts(hosts...))
+		assert.Error(t, err, "%q", hosts)
+	}
+
+	cli, err := New("", WithHosts("a.invalid", "https://b.invalid"), WithPorts(80, 81))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "http://a.invalid", cli.Host)
+		assert.Equal(t, "http://a.invalid:81/ping", cli.pingURL(context.Background()))
+		assert.Equal(t, "https://b.invalid:81/ping", cli.pingURL(context.Background()))
+	}
+}
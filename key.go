@@ -0,0 +1,47 @@
+package mds
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseKey splits a key returned by Upload into a group and a filename.
+// A key without a numeric group prefix is returned as is with group 0.
+func ParseKey(key string) (group int, name string, err error) {
+	if err = ValidateKey(key); err != nil {
+		return 0, "", err
+	}
+
+	i := strings.IndexByte(key, '/')
+	if i < 0 {
+		return 0, key, nil
+	}
+	group, err = strconv.Atoi(key[:i])
+	if err != nil || group <= 0 {
+		return 0, key, nil
+	}
+	return group, key[i+1:], nil
+}
+
+// MakeKey constructs a key in the same way as the proxy does on upload.
+// A non-positive group means no group prefix.
+func MakeKey(group int, name string) string {
+	if group <= 0 {
+		return name
+	}
+	return strconv.Itoa(group) + "/" + name
+}
+
+// ValidateKey checks that key is not empty and has no empty path segments
+func ValidateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("malformed key: must not be empty")
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" {
+			return fmt.Errorf("malformed key %q: empty path segment", key)
+		}
+	}
+	return nil
+}
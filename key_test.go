@@ -0,0 +1,34 @@
+package mds
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKey(t *testing.T) {
+	for _, tc := range []struct {
+		key   string
+		group int
+		name  string
+	}{
+		{"3402/file", 3402, "file"},
+		{"3402/dir/file", 3402, "dir/file"},
+		{"file", 0, "file"},
+		{"dir/file", 0, "dir/file"},
+		{"0/file", 0, "0/file"},
+		{"-1/file", 0, "-1/file"},
+	} {
+		group, name, err := ParseKey(tc.key)
+		if assert.NoError(t, err, tc.key) {
+			assert.Equal(t, tc.group, group, tc.key)
+			assert.Equal(t, tc.name, name, tc.key)
+			assert.Equal(t, tc.key, MakeKey(group, name), tc.key)
+		}
+	}
+
+	for _, malformed := range []string{"", "/file", "3402/", "3402//file"} {
+		_, _, err := ParseKey(malformed)
+		assert.Error(t, err, malformed)
+	}
+}
@@ -0,0 +1,296 @@
+package mds
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Defaults used by LargeUpload
+const (
+	DefaultChunkSize     = 64 << 20
+	DefaultChunkAttempts = 3
+)
+
+// manifestVersion marks manifests written by LargeUpload
+const manifestVersion = 1
+
+// LargeUploadOptions tune LargeUpload
+type LargeUploadOptions struct {
+	// ChunkSize is a size of every chunk but the last one.
+	// DefaultChunkSize is used if it's not set.
+	ChunkSize int64
+	// Concurrency limits chunks uploaded at once, every one of them is held in memory.
+	// BatchConcurrency is used if it's not set.
+	Concurrency int
+	// Retry is applied to every chunk and the manifest, so a dropped connection
+	// costs a single chunk. DefaultChunkAttempts are made if MaxAttempts is not set.
+	Retry RetryPolicy
+}
+
+// Manifest lists chunks of an object uploaded by LargeUpload.
+// It's stored as JSON.
+type Manifest struct {
+	Version   int             `json:"version"`
+	Size      int64           `json:"size"`
+	ChunkSize int64           `json:"chunk_size"`
+	Chunks    []ManifestChunk `json:"chunks"`
+}
+
+// ManifestChunk is a single chunk of a large object
+type ManifestChunk struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+func chunkFilename(filename string, n int) string {
+	return fmt.Sprintf("%s.chunk%06d", filename, n)
+}
+
+// LargeUpload splits body into chunks uploaded concurrently as separate objects
+// named filename.chunkNNNNNN, and then uploads Manifest listing them as filename.
+// Unlike Upload, an object of any size is sent by reasonably small requests,
+// each one retried on its own. If the upload fails or ctx is canceled, uploaded chunks are deleted,
+// it's the best effort: a chunk interrupted by the failure may be left.
+// UploadInfo describes the manifest, its Key is passed to OpenLarge to read the object.
+func (m *Client) LargeUpload(ctx context.Context, namespace, filename string, body io.Reader, opts LargeUploadOptions) (*UploadInfo, *Manifest, error) {
+	opts = m.largeUploadDefaults(opts)
+
+	uctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		manifest = Manifest{Version: manifestVersion, ChunkSize: opts.ChunkSize}
+		// slots bound chunks held in memory
+		slots = make(chan struct{}, opts.Concurrency)
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+		mu.Unlock()
+	}
+
+	for n := 0; ; n++ {
+		select {
+		case slots <- struct{}{}:
+		case <-uctx.Done():
+		}
+		if uctx.Err() != nil {
+			fail(uctx.Err())
+			break
+		}
+
+		data := make([]byte, opts.ChunkSize)
+		size, err := io.ReadFull(body, data)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			<-slots
+			if err != io.EOF {
+				fail(err)
+			}
+			break
+		}
+
+		mu.Lock()
+		manifest.Chunks = append(manifest.Chunks, ManifestChunk{Size: int64(size)})
+		manifest.Size += int64(size)
+		mu.Unlock()
+
+		wg.Add(1)
+		go func(n int, data []byte) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			if err := m.batch.acquire(uctx); err != nil {
+				fail(err)
+				return
+			}
+			defer m.batch.release()
+
+			key, err := m.uploadChunk(uctx, namespace, filename, n, data, opts.Retry)
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			mu.Lock()
+			manifest.Chunks[n].Key = key
+			mu.Unlock()
+		}(n, data[:size])
+
+		if size < len(data) {
+			break
+		}
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		m.deleteChunks(ctx, namespace, manifest.Chunks)
+		return nil, nil, firstErr
+	}
+
+	info, err := m.uploadManifest(ctx, namespace, filename, &manifest, opts.Retry)
+	if err != nil {
+		m.deleteChunks(ctx, namespace, manifest.Chunks)
+		return nil, nil, err
+	}
+	return info, &manifest, nil
+}
+
+func (m *Client) largeUploadDefaults(opts LargeUploadOptions) LargeUploadOptions {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultChunkSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = m.BatchConcurrency
+	}
+	if opts.Retry.MaxAttempts <= 0 {
+		opts.Retry.MaxAttempts = DefaultChunkAttempts
+	}
+	return opts
+}
+
+// uploadChunk uploads chunk n of filename and returns its key
+func (m *Client) uploadChunk(ctx context.Context, namespace, filename string, n int, data []byte, policy RetryPolicy) (string, error) {
+	var info *UploadInfo
+	err := m.retryWith(ctx, policy, func() (err error) {
+		info, err = m.Upload(ctx, namespace, chunkFilename(filename, n), int64(len(data)), bytes.NewReader(data))
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("chunk %d: %w", n, err)
+	}
+	return info.Key, nil
+}
+
+func (m *Client) uploadManifest(ctx context.Context, namespace, filename string, manifest *Manifest, policy RetryPolicy) (*UploadInfo, error) {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	var info *UploadInfo
+	err = m.retryWith(ctx, policy, func() (err error) {
+		info, err = m.Upload(ctx, namespace, filename, int64(len(data)), bytes.NewReader(data))
+		return err
+	})
+	return info, err
+}
+
+// deleteChunks removes uploaded chunks, it's the best effort
+// cleanupTimeout limits deletes of chunks left by a failed LargeUpload
+const cleanupTimeout = 30 * time.Second
+
+// detachedContext keeps values of a context, but not its deadline and cancellation
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// deleteChunks is the best effort. It's run when ctx might be already canceled,
+// so it gets its own cleanupTimeout instead.
+func (m *Client) deleteChunks(ctx context.Context, namespace string, chunks []ManifestChunk) {
+	ctx, cancel := context.WithTimeout(detachedContext{ctx}, cleanupTimeout)
+	defer cancel()
+
+	var keys []string
+	for _, chunk := range chunks {
+		if chunk.Key != "" {
+			keys = append(keys, chunk.Key)
+		}
+	}
+	m.BatchDelete(ctx, namespace, keys, 0)
+}
+
+// OpenLarge reads Manifest stored by LargeUpload at key and returns a reader
+// of the whole object, which fetches chunks one by one.
+// A chunk of a size other than listed in the manifest fails with SizeMismatchError.
+// User is responsible for closing the reader.
+func (m *Client) OpenLarge(ctx context.Context, namespace, key string) (io.ReadCloser, *Manifest, error) {
+	data, err := m.GetFile(ctx, namespace, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("%s is not a manifest: %v", key, err)
+	}
+	if manifest.Version != manifestVersion {
+		return nil, nil, fmt.Errorf("%s is not a manifest of a supported version: %d", key, manifest.Version)
+	}
+
+	return &largeReader{m: m, ctx: ctx, namespace: namespace, chunks: manifest.Chunks}, &manifest, nil
+}
+
+// largeReader reads chunks of a large object in order
+type largeReader struct {
+	m         *Client
+	ctx       context.Context
+	namespace string
+
+	chunks []ManifestChunk
+	// cur is a body of chunks[0], read is a number of bytes read from it
+	cur  io.ReadCloser
+	read int64
+	// err is returned by every Read once a chunk turns out to be broken
+	err error
+}
+
+func (r *largeReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	for len(r.chunks) > 0 {
+		chunk := r.chunks[0]
+		if r.cur == nil {
+			body, err := r.m.Get(r.ctx, r.namespace, chunk.Key)
+			if err != nil {
+				return 0, err
+			}
+			r.cur, r.read = body, 0
+		}
+
+		n, err := r.cur.Read(p)
+		r.read += int64(n)
+		if r.read > chunk.Size || (err == io.EOF && r.read != chunk.Size) {
+			r.Close()
+			r.err = SizeMismatchError{Declared: chunk.Size, Observed: r.read}
+			return n, r.err
+		}
+		switch {
+		case err == io.EOF:
+			r.cur.Close()
+			r.cur = nil
+			r.chunks = r.chunks[1:]
+		case err != nil:
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+	return 0, io.EOF
+}
+
+func (r *largeReader) Close() error {
+	r.chunks = nil
+	if r.cur != nil {
+		err := r.cur.Close()
+		r.cur = nil
+		return err
+	}
+	return nil
+}
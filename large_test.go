@@ -0,0 +1,203 @@
+package mds
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// storeServer keeps uploaded objects in memory under keys 1/filename
+type storeServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	// fail returns a status to reply to an upload of filename instead of storing it
+	fail func(filename string) int
+}
+
+func newStoreServer() *storeServer {
+	s := &storeServer{objects: make(map[string][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+		if len(parts) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		switch handle, name := parts[0], parts[1]; {
+		case strings.HasPrefix(handle, "upload-"):
+			if s.fail != nil {
+				if status := s.fail(name); status != 0 {
+					w.WriteHeader(status)
+					return
+				}
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			s.objects["1/"+name] = body
+			fmt.Fprintf(w, `<post obj="ns.%s" id="0:1" groups="2" size="%d" key="1/%s"><written>2</written></post>`, name, len(body), name)
+		case strings.HasPrefix(handle, "get-"):
+			body, ok := s.objects[name]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(body)
+		case strings.HasPrefix(handle, "delete-"):
+			delete(s.objects, name)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return s
+}
+
+func (s *storeServer) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func TestLargeUpload(t *testing.T) {
+	srv := newStoreServer()
+	defer srv.Close()
+
+	cli := newTestClient(t, srv.Server)
+	cli.setClock(newFakeClock())
+	ctx := context.Background()
+
+	// the second chunk fails once
+	failed := false
+	srv.fail = func(filename string) int {
+		if filename == "big.chunk000001" && !failed {
+			failed = true
+			return http.StatusServiceUnavailable
+		}
+		return 0
+	}
+
+	blob := bytes.Repeat([]byte("TESTBLOB"), 100)
+	info, manifest, err := cli.LargeUpload(ctx, "ns", "big", bytes.NewReader(blob), LargeUploadOptions{ChunkSize: 300, Concurrency: 2})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	srv.mu.Lock()
+	assert.True(t, failed)
+	srv.mu.Unlock()
+	assert.Equal(t, "1/big", info.Key)
+	assert.Equal(t, int64(len(blob)), manifest.Size)
+	assert.Equal(t, []ManifestChunk{
+		{Key: "1/big.chunk000000", Size: 300},
+		{Key: "1/big.chunk000001", Size: 300},
+		{Key: "1/big.chunk000002", Size: 200},
+	}, manifest.Chunks)
+
+	rd, stored, err := cli.OpenLarge(ctx, "ns", info.Key)
+	if assert.NoError(t, err) {
+		body, err := ioutil.ReadAll(rd)
+		assert.NoError(t, err)
+		assert.Equal(t, blob, body)
+		assert.NoError(t, rd.Close())
+		assert.Equal(t, manifest, stored)
+	}
+
+	// a chunk of a wrong size is detected
+	srv.mu.Lock()
+	srv.objects["1/big.chunk000001"] = []byte("SHORT")
+	srv.mu.Unlock()
+	rd, _, err = cli.OpenLarge(ctx, "ns", info.Key)
+	if assert.NoError(t, err) {
+		_, err = ioutil.ReadAll(rd)
+		assert.True(t, errors.Is(err, ErrSizeMismatch), "%v", err)
+		// the object is not read past a broken chunk
+		_, err = rd.Read(make([]byte, 8))
+		assert.True(t, errors.Is(err, ErrSizeMismatch), "%v", err)
+		rd.Close()
+	}
+
+	_, _, err = cli.OpenLarge(ctx, "ns", "1/big.chunk000000")
+	assert.Error(t, err)
+}
+
+func TestLargeUploadFailure(t *testing.T) {
+	srv := newStoreServer()
+	defer srv.Close()
+
+	cli := newTestClient(t, srv.Server)
+	cli.setClock(newFakeClock())
+	srv.fail = func(filename string) int {
+		if filename == "big.chunk000002" {
+			return http.StatusInternalServerError
+		}
+		return 0
+	}
+
+	blob := bytes.Repeat([]byte("TESTBLOB"), 100)
+	_, _, err := cli.LargeUpload(context.Background(), "ns", "big", bytes.NewReader(blob), LargeUploadOptions{ChunkSize: 100, Concurrency: 1})
+	var mErr MethodError
+	if assert.True(t, errors.As(err, &mErr), "%v", err) {
+		assert.Equal(t, http.StatusInternalServerError, mErr.StatusCode)
+	}
+	// uploaded chunks are cleaned up
+	assert.Empty(t, srv.keys())
+}
+
+func TestLargeUploadCanceled(t *testing.T) {
+	srv := newStoreServer()
+	defer srv.Close()
+
+	cli := newTestClient(t, srv.Server)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv.fail = func(filename string) int {
+		if filename == "big.chunk000003" {
+			cancel()
+			return http.StatusInternalServerError
+		}
+		return 0
+	}
+
+	blob := bytes.Repeat([]byte("TESTBLOB"), 100)
+	_, _, err := cli.LargeUpload(ctx, "ns", "big", bytes.NewReader(blob), LargeUploadOptions{ChunkSize: 100, Concurrency: 1})
+	assert.Error(t, err)
+	// chunks are cleaned up despite the canceled context
+	assert.Empty(t, srv.keys())
+}
+
+func TestLargeUploadEmpty(t *testing.T) {
+	srv := newStoreServer()
+	defer srv.Close()
+
+	cli := newTestClient(t, srv.Server)
+	ctx := context.Background()
+
+	info, manifest, err := cli.LargeUpload(ctx, "ns", "empty", bytes.NewReader(nil), LargeUploadOptions{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Empty(t, manifest.Chunks)
+
+	rd, _, err := cli.OpenLarge(ctx, "ns", info.Key)
+	if assert.NoError(t, err) {
+		body, err := ioutil.ReadAll(rd)
+		assert.NoError(t, err)
+		assert.Empty(t, body)
+		rd.Close()
+	}
+}
@@ -1,13 +1,20 @@
 package mds
 
 import (
+	"bufio"
+	"crypto/tls"
+	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/net/context"
 	"golang.org/x/net/context/ctxhttp"
@@ -18,24 +25,83 @@ type UploadInfo struct {
 	XMLName xml.Name `xml:"post"`
 	Obj     string   `xml:"obj,attr"`
 	ID      string   `xml:"id,attr"`
-	Key     string   `xml:"key,attr"`
-	Size    uint64   `xml:"size,attr"`
-	Groups  int      `xml:"groups,attr"`
+	// Key addresses the object in Get, Delete and other methods.
+	// It's "group/filename" rather than a filename passed to Upload, see ParseKey.
+	Key    string `xml:"key,attr"`
+	Size   uint64 `xml:"size,attr"`
+	Groups int    `xml:"groups,attr"`
 
-	Complete []struct {
-		Addr   string `xml:"addr,attr"`
-		Path   string `xml:"path,attr"`
-		Group  int    `xml:"group,attr"`
-		Status int    `xml:"status,attr"`
-	} `xml:"complete"`
+	Complete []Replica `xml:"complete"`
 
 	Written int `xml:"written"`
+
+	// Filename is a filename passed to Upload
+	Filename string `xml:"-"`
+}
+
+// uploadInfoRoots are root element names of an upload reply used by different proxy versions
+var uploadInfoRoots = []string{"post", "upload"}
+
+// UnmarshalXML decodes UploadInfo from any of known root elements
+func (u *UploadInfo) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	known := false
+	for _, root := range uploadInfoRoots {
+		known = known || start.Name.Local == root
+	}
+	if !known {
+		return fmt.Errorf("unexpected element <%s> in upload reply", start.Name.Local)
+	}
+
+	// plain has no UnmarshalXML, but still insists on <post> because of XMLName
+	type plain UploadInfo
+	name := start.Name
+	start.Name.Local = "post"
+	if err := d.DecodeElement((*plain)(u), &start); err != nil {
+		return err
+	}
+	u.XMLName = name
+	return nil
+}
+
+// Replica describes a copy of uploaded data stored in a group
+type Replica struct {
+	Addr   string `xml:"addr,attr"`
+	Path   string `xml:"path,attr"`
+	Group  int    `xml:"group,attr"`
+	Status int    `xml:"status,attr"`
+}
+
+// Healthy reports whether the replica was written successfully
+func (r Replica) Healthy() bool {
+	return r.Status == 0
+}
+
+// HealthyReplica returns the first successfully written replica.
+func (u *UploadInfo) HealthyReplica() (Replica, bool) {
+	for _, replica := range u.Complete {
+		if replica.Healthy() {
+			return replica, true
+		}
+	}
+	return Replica{}, false
 }
 
 func decodeXML(result interface{}, body io.Reader) error {
 	return xml.NewDecoder(body).Decode(result)
 }
 
+// decodeXMLResponse is like decodeXML, but fails early with ContentTypeError
+// if the response looks like an HTML page.
+func decodeXMLResponse(result interface{}, resp *http.Response) error {
+	body := bufio.NewReader(resp.Body)
+	// an error is reported by Decode anyway
+	head, _ := body.Peek(snippetSize)
+	if err := checkNotHTML(resp, head); err != nil {
+		return err
+	}
+	return decodeXML(result, body)
+}
+
 // DownloadInfo describes a direct link to a file
 type DownloadInfo struct {
 	XMLName xml.Name `xml:"download-info"`
@@ -48,7 +114,63 @@ type DownloadInfo struct {
 
 // URL constructs a direct link from DownloadInfo
 func (d *DownloadInfo) URL() string {
-	return fmt.Sprintf("http://%s%s?ts=%ssign=%s", d.Host, d.Path, d.TS, d.Sign)
+	return fmt.Sprintf("http://%s%s?ts=%s&sign=%s", d.Host, d.Path, d.TS, d.Sign)
+}
+
+// RegionURL constructs a direct link like URL, but with a host chosen by regionHost,
+// e.g. a CDN host serving the region. Host is used if region is negative (-1 means no region)
+// or regionHost is nil or returns an empty string.
+func (d *DownloadInfo) RegionURL(regionHost func(region int) string) string {
+	if regionHost == nil || d.Region < 0 {
+		return d.URL()
+	}
+	host := regionHost(d.Region)
+	if host == "" {
+		return d.URL()
+	}
+	return fmt.Sprintf("http://%s%s?ts=%s&sign=%s", host, d.Path, d.TS, d.Sign)
+}
+
+// RegionHostTemplate returns a function for RegionURL and Config.RegionHost,
+// which substitutes a region into every {region} placeholder of template,
+// e.g. "cdn-{region}.example.net".
+func RegionHostTemplate(template string) func(region int) string {
+	return func(region int) string {
+		return strings.Replace(template, "{region}", strconv.Itoa(region), -1)
+	}
+}
+
+// Timestamp decodes TS, which is a moment when the link was signed.
+// MDS encodes it as a hexadecimal number of microseconds since Unix epoch.
+func (d *DownloadInfo) Timestamp() (time.Time, error) {
+	usec, err := strconv.ParseInt(d.TS, 16, 64)
+	if err != nil || usec < 0 {
+		return time.Time{}, fmt.Errorf("malformed ts %q", d.TS)
+	}
+	return time.Unix(usec/1e6, (usec%1e6)*1e3), nil
+}
+
+// VerifyDownloadInfo checks that info describes a well-formed direct link,
+// which was signed less than ttl ago, so it could be rejected before fetching.
+// A non-positive ttl disables the expiration check.
+// The signature itself can't be verified by the client, since it's computed
+// by storage with a key unknown to the client.
+// Returned errors match ErrSignatureInvalid or ErrSignatureExpired with errors.Is.
+func VerifyDownloadInfo(info *DownloadInfo, ttl time.Duration) error {
+	if info.Host == "" || info.Path == "" {
+		return fmt.Errorf("%w: no host or path", ErrSignatureInvalid)
+	}
+	if _, err := hex.DecodeString(info.Sign); err != nil || info.Sign == "" {
+		return fmt.Errorf("%w: malformed sign %q", ErrSignatureInvalid, info.Sign)
+	}
+	ts, err := info.Timestamp()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+	if ttl > 0 && time.Since(ts) > ttl {
+		return fmt.Errorf("%w: signed at %v", ErrSignatureExpired, ts)
+	}
+	return nil
 }
 
 // Config represents configuration for the client
@@ -56,45 +178,260 @@ type Config struct {
 	Host       string
 	UploadPort int
 	ReadPort   int
-
+	// Hosts, if set, replace Host with several proxies sharing the ports.
+	// Requests rotate across them round-robin, and a request failing
+	// to connect to a host is sent to the next one. Requests with bodies
+	// are only resent if http.Request.GetBody is set, e.g. for bytes.Reader.
+	Hosts []string
+	// UseTLS makes hosts without a scheme use https instead of http.
+	// Hosts with http:// are rejected then.
+	UseTLS bool
+	// TLSConfig, if set, replaces TLS configuration of the transport,
+	// e.g. RootCAs with internal CAs of TLS-terminated proxies.
+	TLSConfig *tls.Config
+
+	// AuthHeader is a complete value of Authorization header.
+	// Alternatively AuthScheme and AuthToken could be set
+	// to let the client assemble the header.
 	AuthHeader string
+	AuthScheme string
+	AuthToken  string
+	// ValidateAuth makes NewClient check AuthHeader with ValidateAuthHeader,
+	// so a malformed header is reported before any request.
+	ValidateAuth bool
+
+	// DeleteHost and DeletePort override the endpoint used to delete keys.
+	// Host and UploadPort are used if they are not set.
+	DeleteHost string
+	DeletePort int
+	// DeleteMode is used by Delete. HardDelete is assumed if it's not set.
+	DeleteMode DeleteMode
+	// SoftDeleteQuery is a raw query added to delete URLs in SoftDelete mode,
+	// as documented by a proxy which supports soft deletes.
+	// SoftDelete fails if it's not set.
+	SoftDeleteQuery string
+	// ConfirmDelete makes deletes check with HEAD that a key is actually gone.
+	// Proxies differ in replies to deletes of missing keys: some return 404,
+	// others 200, and storage may remove objects asynchronously.
+	// The confirmation fails with an error matching ErrStillPending
+	// if the key is still readable. See also WaitDeleted.
+	ConfirmDelete bool
+
+	// BatchConcurrency limits a number of requests issued concurrently
+	// by batch methods of the client, like StatMany. 16 is used if it's not set.
+	BatchConcurrency int
+
+	// MaxRedirects limits a number of redirects followed by a request.
+	// 10 is used if it's not set, a negative value disables following.
+	MaxRedirects int
+	// RedirectPolicy, if set, decides whether to follow a redirect,
+	// e.g. based on a target host. Returning an error stops following.
+	// Authorization header is forwarded only to the same host regardless of the policy.
+	RedirectPolicy func(req *http.Request, via []*http.Request) error
+
+	// Cache, if set, is consulted by Get, GetFile and OpenObject
+	// before hitting the proxy. Ranged reads and reads with credentials
+	// set by WithAuthHeader bypass it, so a body is never shared across credentials.
+	// Concurrent reads of the same key are coalesced into one request.
+	// Bodies of up to 1MiB are buffered to be shared, larger ones are streamed
+	// and fetched by every concurrent reader on its own.
+	// See FSCache and MemCache.
+	Cache Cache
+
+	// EnableHTTP2 makes the client attempt HTTP/2 over TLS
+	// even if a custom *http.Transport is provided.
+	//
+	// HTTP/2 multiplexes concurrent requests over a single connection,
+	// which saves connection setup for lots of small requests.
+	// On the other hand all streams share one TCP connection,
+	// so a loss on it stalls every request (head-of-line blocking)
+	// and large transfers compete for the same window.
+	// Workloads dominated by big uploads and downloads are usually better
+	// with a pool of HTTP/1.1 connections.
+	EnableHTTP2 bool
+	// Transport, if set, is used by NewClient instead of NewTransport defaults
+	// when no *http.Client is provided, e.g. to add instrumentation.
+	Transport http.RoundTripper
+	// DialContext, if set, is used by the transport to establish connections,
+	// e.g. to tune socket options or bind a source address.
+	DialContext DialContext
+	// MaxConnsPerHost, if set, caps connections to a single proxy host
+	// on top of BatchConcurrency, which limits requests regardless of hosts.
+	// See TransportOptions.MaxConnsPerHost.
+	MaxConnsPerHost int
+	// DialTimeout, TLSHandshakeTimeout and ResponseHeaderTimeout override
+	// timeouts of the transport, which defaults to NewTransport ones:
+	// DefaultDialTimeout, DefaultTLSHandshakeTimeout and DefaultResponseHeaderTimeout.
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	// RequestTimeout limits a whole request including reading a body,
+	// see http.Client.Timeout. There is no limit by default, because
+	// big objects take long to transfer. Prefer deadlines of contexts.
+	RequestTimeout time.Duration
+	// CopyBufferSize is a size of buffers copying bodies, e.g. in DownloadTo.
+	// Larger buffers reduce syscalls on fast links with high latency.
+	// DefaultCopyBufferSize is used if it's not set.
+	CopyBufferSize int
+
+	// HostHeader, if set, is sent as Host header of every request,
+	// while connections are still established to Host, e.g. to reach
+	// a virtual-hosted proxy or a particular backend behind a shared address.
+	HostHeader string
+
+	// Retry makes Get, Delete, Ping and DownloadInfo retry transient failures.
+	// There are no retries by default.
+	Retry RetryPolicy
+
+	// Breaker enables circuit breakers per proxy endpoint. See BreakerPolicy.
+	Breaker BreakerPolicy
+
+	// SuccessStatuses overrides statuses considered a success, to adapt to proxy versions.
+	// It's keyed by an operation name, which is ErrorMethodScope.Method of its errors:
+	// "upload" (Upload and all uploading methods), "delete", "ping" (Ping),
+	// "stat" (Stat, Exists and WaitDeleted), "touch" and "downloadInfo".
+	// By default upload succeeds with any 2xx status, others with 200 only.
+	// Reads of bodies can't be overridden, they accept 200 and 206 for ranges.
+	SuccessStatuses map[string][]int
+
+	// RegionHost, if set, chooses a host of direct links built by UploadAndSign
+	// for a region reported by DownloadInfo. See DownloadInfo.RegionURL.
+	RegionHost func(region int) string
+}
+
+// success reports whether code is a success of an operation, see Config.SuccessStatuses
+func (m *Client) success(operation string, code int) bool {
+	if statuses, ok := m.SuccessStatuses[operation]; ok {
+		for _, status := range statuses {
+			if status == code {
+				return true
+			}
+		}
+		return false
+	}
+
+	if operation == "upload" {
+		return code >= 200 && code <= 299
+	}
+	return code == http.StatusOK
 }
 
 // Client works with MDS
 type Client struct {
 	Config
 
-	client *http.Client
+	client   *http.Client
+	batch    limiter
+	flights  flightGroup
+	clock    Clock
+	breakers *breakerTransport
+	hosts    *hostPool
+	// copyBuffers hold buffers of CopyBufferSize
+	copyBuffers *sync.Pool
 }
 
-// NewClient creates a client to MDS
+// NewClient creates a client to MDS.
+// If client is nil, a client with Config.Transport or NewTransport defaults is used.
+// It's the same as New with WithConfig and WithHTTPClient options.
 func NewClient(config Config, client *http.Client) (*Client, error) {
+	return New(config.Host,
+		WithConfig(func(c *Config) { *c = config }),
+		WithHTTPClient(client),
+	)
+}
+
+func newClient(config Config, client *http.Client) (*Client, error) {
 	if client == nil {
-		client = http.DefaultClient
+		transport := config.Transport
+		if transport == nil {
+			transport = NewTransport(TransportOptions{})
+		}
+		client = &http.Client{
+			Transport: transport,
+		}
+	} else if config.Transport != nil {
+		return nil, fmt.Errorf("both client and Transport are set")
 	}
 
-	if !(strings.HasPrefix(config.Host, "http://") || strings.HasPrefix(config.Host, "https://")) {
-		config.Host = "http://" + config.Host
+	if config.AuthToken != "" {
+		if config.AuthHeader != "" {
+			return nil, fmt.Errorf("both AuthHeader and AuthToken are set")
+		}
+		header, err := AuthorizationHeader(config.AuthScheme, config.AuthToken)
+		if err != nil {
+			return nil, err
+		}
+		config.AuthHeader = header
+	}
+
+	if config.ValidateAuth {
+		if err := ValidateAuthHeader(config.AuthHeader); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.DeleteMode == SoftDelete && config.SoftDeleteQuery == "" {
+		return nil, fmt.Errorf("DeleteMode is SoftDelete, but SoftDeleteQuery is not set")
+	}
+
+	if config.HostHeader != "" {
+		if err := validateHostHeader(config.HostHeader); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, host := range []string{config.Host, config.DeleteHost} {
+		if err := checkScheme(host, config.UseTLS); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := withTransportOptions(client, config)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts *hostPool
+	if len(config.Hosts) > 0 {
+		if hosts, err = newHostPool(config.Hosts, config.UseTLS); err != nil {
+			return nil, err
+		}
+		config.Host = hosts.hosts[0]
+	}
+
+	client, breakers := withBreakers(client, config.Breaker)
+	client = withFailover(client, hosts)
+	client = withRedirectPolicy(client, config.MaxRedirects, config.RedirectPolicy)
+
+	config.Host = withScheme(config.Host, config.UseTLS)
+	if config.DeleteHost != "" {
+		config.DeleteHost = withScheme(config.DeleteHost, config.UseTLS)
+	}
+
+	if config.BatchConcurrency <= 0 {
+		config.BatchConcurrency = defaultBatchConcurrency
 	}
 
 	return &Client{
 		Config: config,
 
-		client: client,
-	}, nil
-}
+		client:   client,
+		batch:    make(limiter, config.BatchConcurrency),
+		clock:    realClock{},
+		breakers: breakers,
+		hosts:    hosts,
 
-func (m *Client) uploadURL(namespace, filename string) string {
-	return fmt.Sprintf("%s:%d/upload-%s/%s", m.Host, m.UploadPort, namespace, filename)
+		copyBuffers: newCopyBufferPool(config.CopyBufferSize),
+	}, nil
 }
 
 // ReadURL returns a URL which could be used to get data.
 func (m *Client) ReadURL(ctx context.Context, namespace, filename string, resolveRedirect bool) (string, error) {
 	if !resolveRedirect {
-		return fmt.Sprintf("%s:%d/get-%s/%s", m.Host, m.ReadPort, namespace, filename), nil
+		return m.readURL(ctx, namespace, filename), nil
 	}
 
-	rurl := fmt.Sprintf("%s:%d/get-%s/%s?redirect=yes", m.Host, m.ReadPort, namespace, filename)
+	rurl := m.readURL(ctx, namespace, filename) + "?redirect=yes"
 
 	var noRedirectClient = http.Client{
 		Transport: m.client.Transport,
@@ -105,7 +442,12 @@ func (m *Client) ReadURL(ctx context.Context, namespace, filename string, resolv
 		},
 	}
 
-	resp, err := ctxhttp.Head(ctx, &noRedirectClient, rurl)
+	req, err := m.newRequest(ctx, "HEAD", rurl, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := ctxhttp.Do(ctx, &noRedirectClient, req)
 	if err != nil {
 		return "", err
 	}
@@ -120,33 +462,22 @@ func (m *Client) ReadURL(ctx context.Context, namespace, filename string, resolv
 		}
 		return durl.String(), nil
 	default:
-		return "", fmt.Errorf("unexpected code for resolving redirect %d", resp.StatusCode)
+		scope := ErrorMethodScope{
+			Method:    "readURL",
+			URL:       rurl,
+			Namespace: namespace,
+			Key:       filename,
+		}
+		return "", newMethodError(scope, resp)
 	}
 }
 
-func (m *Client) deleteURL(namespace, filename string) string {
-	return fmt.Sprintf("%s:%d/delete-%s/%s", m.Host, m.UploadPort, namespace, filename)
-}
-
-func (m *Client) pingURL() string {
-	return fmt.Sprintf("%s:%d/ping", m.Host, m.ReadPort)
-}
-
-func (m *Client) downloadinfoURL(namespace, filename string) string {
-	return fmt.Sprintf("%s:%d/downloadinfo-%s/%s", m.Host, m.ReadPort, namespace, filename)
-}
-
-func (m *Client) getRealURL() string {
-	return fmt.Sprintf("%s:%d/hostname", m.Host, m.UploadPort)
-}
-
 func (m *Client) GetReal(ctx context.Context) (string, error) {
-	urlStr := m.getRealURL()
-	req, err := http.NewRequest("GET", urlStr, nil)
+	urlStr := m.getRealURL(ctx)
+	req, err := m.newRequest(ctx, "GET", urlStr, nil)
 	if err != nil {
 		return "", err
 	}
-	req.Header.Add("Authorization", m.AuthHeader)
 
 	resp, err := ctxhttp.Do(ctx, m.client, req)
 	if err != nil {
@@ -167,98 +498,312 @@ func (m *Client) GetReal(ctx context.Context) (string, error) {
 }
 
 // Upload stores provided data to a specified namespace. Returns information about upload.
-func (m *Client) Upload(ctx context.Context, namespace string, filename string, size int64, body io.Reader) (*UploadInfo, error) {
-	urlStr := m.uploadURL(namespace, filename)
-	req, err := http.NewRequest("POST", urlStr, body)
+// The body is not buffered by the client: it's streamed to the proxy as it's read,
+// so there is nothing to flush. To produce data incrementally pass the reading end of io.Pipe.
+// Any 2xx status is a success by default, see Config.SuccessStatuses. A body with UploadInfo is required
+// unless the status is 204 No Content. If the proxy reports no key, e.g. on 204,
+// UploadInfo with Filename is returned along with an error matching ErrNoKey,
+// since the object can't be read without a key.
+// The proxy accepts an object in a single request and can't resume an interrupted one,
+// so the upload must be restarted from the beginning.
+// Options, e.g. WithExpire, tune the upload. A cached body of the key is dropped.
+func (m *Client) Upload(ctx context.Context, namespace string, filename string, size int64, body io.Reader, opts ...UploadOption) (*UploadInfo, error) {
+	o := newUploadOptions(opts)
+	query, err := o.query()
+	if err != nil {
+		return nil, err
+	}
+	urlStr := m.uploadURL(ctx, namespace, filename)
+	if len(query) > 0 {
+		urlStr += "?" + query.Encode()
+	}
+	req, err := m.newRequest(ctx, "POST", urlStr, body)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("Authorization", m.AuthHeader)
 	if req.ContentLength <= 0 {
 		req.ContentLength = size
 	}
+	if o.checksum != nil {
+		withChecksum(req, o.checksum)
+	}
+
+	var counter *countingReader
+	if req.Body != nil && req.ContentLength > 0 {
+		counter = &countingReader{ReadCloser: req.Body}
+		req.Body = counter
+		if getBody := req.GetBody; getBody != nil {
+			// a body sent again, e.g. to another of Hosts, is counted from scratch
+			req.GetBody = func() (io.ReadCloser, error) {
+				body, err := getBody()
+				if err != nil {
+					return nil, err
+				}
+				counter = &countingReader{ReadCloser: body}
+				return counter, nil
+			}
+		}
+	}
 
 	resp, err := ctxhttp.Do(ctx, m.client, req)
 	if err != nil {
+		if counter != nil && counter.mismatch(req.ContentLength) {
+			return nil, SizeMismatchError{
+				Declared: req.ContentLength,
+				Observed: counter.count(),
+			}
+		}
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	if !m.success("upload", resp.StatusCode) {
 		scope := ErrorMethodScope{
-			Method: "upload",
-			URL:    urlStr,
+			Method:    "upload",
+			URL:       urlStr,
+			Namespace: namespace,
+			Key:       filename,
 		}
 		return nil, newMethodError(scope, resp)
 	}
 
 	var info UploadInfo
-	if err := decodeXML(&info, resp.Body); err != nil {
-		return nil, err
+	if resp.StatusCode != http.StatusNoContent {
+		if err := decodeXMLResponse(&info, resp); err != nil {
+			return nil, err
+		}
+	}
+	info.Filename = filename
+	if info.Key == "" {
+		return &info, fmt.Errorf("%w: upload of %s replied with status %d", ErrNoKey, filename, resp.StatusCode)
 	}
+	// the key might be overwritten
+	m.InvalidateCache(namespace, info.Key)
 
 	return &info, nil
 }
 
 // Get reads a given key from storage and return ReadCloser to body.
+// The key is UploadInfo.Key, the proxy can't look an object up by a filename.
+// Range is either a start offset or start and end offsets,
+// the end is inclusive like in HTTP: 2, 4 reads 3 bytes.
+// See GetRangeInclusive and GetRangeHalfOpen for explicit alternatives.
 // User is responsible for closing returned ReadCloser.
 func (m *Client) Get(ctx context.Context, namespace, key string, Range ...uint64) (io.ReadCloser, error) {
-	urlStr, err := m.ReadURL(ctx, namespace, key, false)
+	resp, err := m.get(ctx, namespace, key, Range...)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest("GET", urlStr, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Add("Authorization", m.AuthHeader)
+	return resp.Body, nil
+}
 
+func (m *Client) get(ctx context.Context, namespace, key string, Range ...uint64) (*http.Response, error) {
+	header := make(http.Header)
 	switch len(Range) {
 	case 0:
 	case 1:
-		req.Header.Add("Range", fmt.Sprintf("bytes=%d-", Range[0]))
+		header.Set("Range", fmt.Sprintf("bytes=%d-", Range[0]))
 	case 2:
-		req.Header.Add("Range", fmt.Sprintf("bytes=%d-%d", Range[0], Range[1]))
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", Range[0], Range[1]))
 	default:
 		return nil, fmt.Errorf("Invalid range")
 	}
+	return m.getWithHeader(ctx, namespace, key, header)
+}
+
+// getWithHeader reads key sending header along with the request.
+// The cache is consulted only if there is no Range in header.
+// Failures to get a reply are retried, reading a body is up to a caller.
+func (m *Client) getWithHeader(ctx context.Context, namespace, key string, header http.Header) (resp *http.Response, err error) {
+	err = m.retry(ctx, func() error {
+		resp, err = m.getOnce(ctx, namespace, key, header)
+		return err
+	})
+	return resp, err
+}
+
+func (m *Client) getOnce(ctx context.Context, namespace, key string, header http.Header) (*http.Response, error) {
+	urlStr, err := m.ReadURL(ctx, namespace, key, false)
+	if err != nil {
+		return nil, err
+	}
+	req, err := m.newRequest(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	// the cache isn't keyed by credentials, so request scoped ones must reach the proxy
+	if m.Cache != nil && header.Get("Range") == "" && !hasAuthOverride(ctx) {
+		return m.getCached(ctx, namespace, key, req)
+	}
 
 	resp, err := ctxhttp.Do(ctx, m.client, req)
 	if err != nil {
 		return nil, err
 	}
 
-	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
-		return resp.Body, nil
+	switch resp.StatusCode {
+	case http.StatusOK:
+		resp.Body = &resetClassifyingBody{resp.Body}
+		return resp, nil
+	case http.StatusPartialContent:
+		if err := checkRangeEncoding(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		resp.Body = &resetClassifyingBody{resp.Body}
+		return resp, nil
 	}
 
 	defer resp.Body.Close()
 	scope := ErrorMethodScope{
-		Method: "get",
-		URL:    urlStr,
+		Method:    "get",
+		URL:       urlStr,
+		Namespace: namespace,
+		Key:       key,
 	}
 	return nil, newMethodError(scope, resp)
 }
 
 // GetFile is like Get but returns bytes.
+// If the proxy reports a reasonable Content-Length, the body is read
+// into a slice of exactly that size without reallocations.
 func (m *Client) GetFile(ctx context.Context, namespace, key string, Range ...uint64) ([]byte, error) {
-	output, err := m.Get(ctx, namespace, key, Range...)
+	resp, err := m.get(ctx, namespace, key, Range...)
 	if err != nil {
 		return nil, err
 	}
-	defer output.Close()
+	defer resp.Body.Close()
 
-	return ioutil.ReadAll(output)
+	if resp.ContentLength < 0 || resp.ContentLength > maxExactRead {
+		return ioutil.ReadAll(resp.Body)
+	}
+
+	body := make([]byte, resp.ContentLength)
+	if _, err := io.ReadFull(resp.Body, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// DeleteMode describes how a key is deleted
+type DeleteMode int
+
+const (
+	// DefaultDelete uses DeleteMode from Config.
+	DefaultDelete DeleteMode = iota
+	// HardDelete removes a key and its data.
+	HardDelete
+	// SoftDelete asks the proxy to leave a tombstone instead of removing data.
+	// The proxy must support it, Config.SoftDeleteQuery tells how to ask.
+	SoftDelete
+)
+
+func (d DeleteMode) String() string {
+	switch d {
+	case DefaultDelete:
+		return "default"
+	case HardDelete:
+		return "hard"
+	case SoftDelete:
+		return "soft"
+	default:
+		return fmt.Sprintf("DeleteMode(%d)", int(d))
+	}
 }
 
 // Delete deletes key from namespace.
 func (m *Client) Delete(ctx context.Context, namespace, key string) error {
-	urlStr := m.deleteURL(namespace, key)
-	req, err := http.NewRequest("GET", urlStr, nil)
+	_, err := m.DeleteWithMode(ctx, namespace, key, DefaultDelete)
+	return err
+}
+
+// DeleteIdempotent is like Delete, but a missing key is a success as well,
+// which suits cleanups where "already gone" is fine.
+func (m *Client) DeleteIdempotent(ctx context.Context, namespace, key string) error {
+	err := m.Delete(ctx, namespace, key)
+	var mErr MethodError
+	if errors.As(err, &mErr) && mErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// WaitDeleted polls key every interval until the proxy reports it missing.
+// Deletes may be processed asynchronously by storage, so a key could be readable
+// for a while after Delete succeeds. If ctx is done while the key still exists,
+// the returned error matches ErrStillPending with errors.Is. interval must be positive.
+func (m *Client) WaitDeleted(ctx context.Context, namespace, key string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid poll interval %v", interval)
+	}
+	for {
+		_, err := m.stat(ctx, namespace, key)
+		switch {
+		case errors.Is(err, ErrKeyNotFound):
+			return nil
+		case err == nil:
+		case ctx.Err() != nil:
+			// the request was interrupted
+		default:
+			return err
+		}
+
+		select {
+		case <-m.clock.After(interval):
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %s: %v", ErrStillPending, key, ctx.Err())
+		}
+	}
+}
+
+// DeleteWithMode deletes key from namespace using a given mode and drops it from Cache.
+// DefaultDelete is resolved with Config. Returns the mode which was used.
+func (m *Client) DeleteWithMode(ctx context.Context, namespace, key string, mode DeleteMode) (DeleteMode, error) {
+	if mode == DefaultDelete {
+		mode = m.DeleteMode
+	}
+	if mode == DefaultDelete {
+		mode = HardDelete
+	}
+	if mode == SoftDelete && m.SoftDeleteQuery == "" {
+		return mode, fmt.Errorf("soft delete of %s: SoftDeleteQuery is not set", key)
+	}
+
+	err := m.retry(ctx, func() error {
+		return m.delete(ctx, namespace, key, mode)
+	})
+	// a cached body of a missing key must not be served anymore
+	if err == nil || errors.Is(err, ErrKeyNotFound) {
+		m.InvalidateCache(namespace, key)
+	}
+	if err != nil {
+		return mode, err
+	}
+
+	if m.ConfirmDelete {
+		_, err := m.stat(ctx, namespace, key)
+		switch {
+		case errors.Is(err, ErrKeyNotFound):
+		case err == nil:
+			return mode, fmt.Errorf("%w: %s is still readable after delete", ErrStillPending, key)
+		default:
+			return mode, err
+		}
+	}
+
+	return mode, nil
+}
+
+func (m *Client) delete(ctx context.Context, namespace, key string, mode DeleteMode) error {
+	urlStr := m.deleteURL(ctx, namespace, key, mode)
+	req, err := m.newRequest(ctx, "GET", urlStr, nil)
 	if err != nil {
 		return err
 	}
-	req.Header.Add("Authorization", m.AuthHeader)
 
 	resp, err := ctxhttp.Do(ctx, m.client, req)
 	if err != nil {
@@ -266,32 +811,38 @@ func (m *Client) Delete(ctx context.Context, namespace, key string) error {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	if !m.success("delete", resp.StatusCode) {
 		scope := ErrorMethodScope{
-			Method: "delete",
-			URL:    urlStr,
+			Method:    "delete",
+			URL:       urlStr,
+			Namespace: namespace,
+			Key:       key,
 		}
 		return newMethodError(scope, resp)
 	}
-
 	return nil
 }
 
 // Ping checks availability of proxy
 func (m *Client) Ping(ctx context.Context) error {
-	urlStr := m.pingURL()
-	req, err := http.NewRequest("GET", urlStr, nil)
+	return m.retry(ctx, func() error {
+		return m.ping(ctx)
+	})
+}
+
+func (m *Client) ping(ctx context.Context) error {
+	urlStr := m.pingURL(ctx)
+	req, err := m.newRequest(ctx, "GET", urlStr, nil)
 	if err != nil {
 		return err
 	}
-	req.Header.Add("Authorization", m.AuthHeader)
 	resp, err := ctxhttp.Do(ctx, m.client, req)
 	if err != nil {
 		return err
 	}
 
 	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
+	if !m.success("ping", resp.StatusCode) {
 		scope := ErrorMethodScope{
 			Method: "ping",
 			URL:    urlStr,
@@ -303,14 +854,21 @@ func (m *Client) Ping(ctx context.Context) error {
 
 // DownloadInfo retrieves an information about direct link to a file,
 // if it's available.
-func (m *Client) DownloadInfo(ctx context.Context, namespace, key string) (*DownloadInfo, error) {
-	urlStr := m.downloadinfoURL(namespace, key)
+func (m *Client) DownloadInfo(ctx context.Context, namespace, key string) (info *DownloadInfo, err error) {
+	err = m.retry(ctx, func() error {
+		info, err = m.downloadInfo(ctx, namespace, key)
+		return err
+	})
+	return info, err
+}
+
+func (m *Client) downloadInfo(ctx context.Context, namespace, key string) (*DownloadInfo, error) {
+	urlStr := m.downloadinfoURL(ctx, namespace, key)
 
-	req, err := http.NewRequest("GET", urlStr, nil)
+	req, err := m.newRequest(ctx, "GET", urlStr, nil)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Add("Authorization", m.AuthHeader)
 
 	resp, err := ctxhttp.Do(ctx, m.client, req)
 	if err != nil {
@@ -318,18 +876,39 @@ func (m *Client) DownloadInfo(ctx context.Context, namespace, key string) (*Down
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	if !m.success("downloadInfo", resp.StatusCode) {
 		scope := ErrorMethodScope{
-			Method: "downloadInfo",
-			URL:    urlStr,
+			Method:    "downloadInfo",
+			URL:       urlStr,
+			Namespace: namespace,
+			Key:       key,
 		}
 		return nil, newMethodError(scope, resp)
 	}
 
 	var info DownloadInfo
-	if err := decodeXML(&info, resp.Body); err != nil {
+	if err := decodeXMLResponse(&info, resp); err != nil {
 		return nil, err
 	}
 
 	return &info, nil
 }
+
+// UploadAndSign uploads data like Upload and then retrieves a direct link
+// to the uploaded key, so the key and the link are always consistent.
+// The link lives as long as the proxy decides, its lifetime can't be chosen.
+// If the upload succeeds, but the link can't be retrieved,
+// UploadInfo is returned along with the error.
+func (m *Client) UploadAndSign(ctx context.Context, namespace, filename string, size int64, body io.Reader, opts ...UploadOption) (*UploadInfo, string, error) {
+	info, err := m.Upload(ctx, namespace, filename, size, body, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dinfo, err := m.DownloadInfo(ctx, namespace, info.Key)
+	if err != nil {
+		return info, "", err
+	}
+
+	return info, dinfo.RegionURL(m.RegionHost), nil
+}
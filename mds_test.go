@@ -0,0 +1,332 @@
+package mds
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func serverPort(t testing.TB, srv *httptest.Server) int {
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("unable to parse server URL %+v", err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatalf("unable to parse server port %+v", err)
+	}
+	return port
+}
+
+// newTestClient creates a client to srv using it for both upload and read ports.
+func newTestClient(t testing.TB, srv *httptest.Server) *Client {
+	port := serverPort(t, srv)
+	cli, err := NewClient(Config{
+		Host:       "127.0.0.1",
+		UploadPort: port,
+		ReadPort:   port,
+		AuthHeader: "Basic dGVzdDp0ZXN0",
+	}, nil)
+	if err != nil {
+		t.Fatalf("unable to create client %+v", err)
+	}
+	return cli
+}
+
+func TestDeleteURL(t *testing.T) {
+	ctx := context.Background()
+	cli, err := NewClient(Config{
+		Host:            "proxy.net",
+		UploadPort:      1111,
+		ReadPort:        80,
+		SoftDeleteQuery: "tombstone=yes",
+	}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, "http://proxy.net:1111/delete-ns/1/key", cli.deleteURL(ctx, "ns", "1/key", HardDelete))
+	assert.Equal(t, "http://proxy.net:1111/delete-ns/1/key?tombstone=yes", cli.deleteURL(ctx, "ns", "1/key", SoftDelete))
+
+	cli, err = NewClient(Config{
+		Host:            "proxy.net",
+		UploadPort:      1111,
+		ReadPort:        80,
+		DeleteHost:      "delete.proxy.net",
+		DeletePort:      80,
+		SoftDeleteQuery: "tombstone=yes",
+	}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	assert.Equal(t, "http://delete.proxy.net:80/delete-ns/1/key", cli.deleteURL(ctx, "ns", "1/key", HardDelete))
+	assert.Equal(t, "http://delete.proxy.net:80/delete-ns/1/key?tombstone=yes", cli.deleteURL(ctx, "ns", "1/key", SoftDelete))
+}
+
+func TestDeleteViaReadPort(t *testing.T) {
+	upload := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to upload port: %s", r.URL)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upload.Close()
+
+	var paths []string
+	read := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.RequestURI())
+	}))
+	defer read.Close()
+
+	cli, err := NewClient(Config{
+		Host:            "127.0.0.1",
+		UploadPort:      serverPort(t, upload),
+		ReadPort:        serverPort(t, read),
+		DeletePort:      serverPort(t, read),
+		DeleteMode:      SoftDelete,
+		SoftDeleteQuery: "tombstone=yes",
+	}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	ctx := context.Background()
+	assert.NoError(t, cli.Delete(ctx, "ns", "1/key"))
+
+	mode, err := cli.DeleteWithMode(ctx, "ns", "1/key", HardDelete)
+	assert.NoError(t, err)
+	assert.Equal(t, HardDelete, mode)
+
+	mode, err = cli.DeleteWithMode(ctx, "ns", "1/key", DefaultDelete)
+	assert.NoError(t, err)
+	assert.Equal(t, SoftDelete, mode)
+
+	assert.Equal(t, []string{
+		"/delete-ns/1/key?tombstone=yes",
+		"/delete-ns/1/key",
+		"/delete-ns/1/key?tombstone=yes",
+	}, paths)
+}
+
+func TestSoftDeleteWithoutQuery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request: %s", r.URL)
+	}))
+	defer srv.Close()
+
+	port := serverPort(t, srv)
+	_, err := NewClient(Config{
+		Host:       "127.0.0.1",
+		UploadPort: port,
+		ReadPort:   port,
+		DeleteMode: SoftDelete,
+	}, nil)
+	assert.Error(t, err)
+
+	cli, err := NewClient(Config{Host: "127.0.0.1", UploadPort: port, ReadPort: port}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	// a soft delete must not turn into a hard one
+	_, err = cli.DeleteWithMode(context.Background(), "ns", "1/key", SoftDelete)
+	assert.Error(t, err)
+}
+
+func TestDeleteIdempotent(t *testing.T) {
+	var status int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	for _, status = range []int{http.StatusOK, http.StatusNotFound} {
+		assert.NoError(t, cli.DeleteIdempotent(ctx, "ns", "1/key"), "%d", status)
+	}
+
+	status = http.StatusNotFound
+	assert.Error(t, cli.Delete(ctx, "ns", "1/key"))
+
+	status = http.StatusInternalServerError
+	assert.Error(t, cli.DeleteIdempotent(ctx, "ns", "1/key"))
+}
+
+func TestSuccessStatuses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/delete-ns/"):
+			w.WriteHeader(http.StatusNoContent)
+		case strings.HasPrefix(r.URL.Path, "/upload-ns/"):
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, uploadReply)
+		default:
+			// ping and reads of keys
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	// defaults
+	assert.Error(t, cli.Delete(ctx, "ns", "1/key"))
+	_, err := cli.Upload(ctx, "ns", "file", 4, strings.NewReader("TEST"))
+	assert.NoError(t, err)
+	assert.Error(t, cli.Ping(ctx))
+	assert.Error(t, cli.Touch(ctx, "ns", "1/key"))
+
+	cli.SuccessStatuses = map[string][]int{
+		"delete": {http.StatusOK, http.StatusNoContent},
+		"upload": {http.StatusOK},
+		"ping":   {http.StatusNoContent},
+		"touch":  {http.StatusNoContent},
+	}
+	assert.NoError(t, cli.Delete(ctx, "ns", "1/key"))
+	assert.NoError(t, cli.Ping(ctx))
+	assert.NoError(t, cli.Touch(ctx, "ns", "1/key"))
+	_, err = cli.Upload(ctx, "ns", "file", 4, strings.NewReader("TEST"))
+	var mErr MethodError
+	if assert.True(t, errors.As(err, &mErr)) {
+		assert.Equal(t, http.StatusCreated, mErr.StatusCode)
+	}
+}
+
+func TestConfirmDelete(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/delete-ns/"):
+		case r.URL.Path == "/get-ns/1/gone":
+			http.NotFound(w, r)
+		case r.URL.Path == "/get-ns/1/stuck":
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	assert.NoError(t, cli.Delete(ctx, "ns", "1/stuck"))
+
+	cli.ConfirmDelete = true
+	assert.NoError(t, cli.Delete(ctx, "ns", "1/gone"))
+	assert.True(t, errors.Is(cli.Delete(ctx, "ns", "1/stuck"), ErrStillPending))
+	assert.Error(t, cli.Delete(ctx, "ns", "1/broken"))
+}
+
+func TestWaitDeleted(t *testing.T) {
+	var heads, stuck int32
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "HEAD", r.Method)
+		switch r.URL.Path {
+		case "/get-ns/1/pending":
+			if atomic.AddInt32(&heads, 1) > 2 {
+				http.NotFound(w, r)
+			}
+		case "/get-ns/1/stuck":
+			if atomic.AddInt32(&stuck, 1) == 3 {
+				cancel()
+			}
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	clk := newFakeClock()
+	cli.setClock(clk)
+
+	assert.NoError(t, cli.WaitDeleted(context.Background(), "ns", "1/pending", time.Minute))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&heads))
+	assert.Equal(t, []time.Duration{time.Minute, time.Minute}, clk.Waits())
+
+	assert.True(t, errors.Is(cli.WaitDeleted(ctx, "ns", "1/stuck", time.Minute), ErrStillPending))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&stuck))
+
+	ctx = context.Background()
+	err := cli.WaitDeleted(ctx, "ns", "1/broken", time.Minute)
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrStillPending))
+
+	assert.Error(t, cli.WaitDeleted(ctx, "ns", "1/pending", 0))
+}
+
+const uploadReply = `<?xml version="1.0" encoding="utf-8"?>
+<post obj="ns.file" id="0:48f22774edb9...7727258a3cee" groups="2" size="4" key="3402/file">
+<complete addr="192.168.1.1:1025" path="/srv/storage/47/1/data-0.0" group="4643" status="0"/>
+<complete addr="192.168.1.2:1025" path="/srv/storage/60/2/data-0.0" group="3402" status="0"/>
+<written>2</written>
+</post>`
+
+func TestUploadFilename(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/upload-ns/file", r.URL.Path)
+		io.WriteString(w, uploadReply)
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	info, err := cli.Upload(context.Background(), "ns", "file", 4, strings.NewReader("TEST"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "file", info.Filename)
+		assert.Equal(t, "3402/file", info.Key)
+	}
+}
+
+const downloadInfoReply = `<?xml version="1.0" encoding="utf-8"?>
+<download-info>
+	<host>storage-direct.hosts.net</host>
+	<path>/ns/21/2/data-0.1:42968596189:2077462</path>
+	<ts>50b5c7ad2accf</ts>
+	<region>-1</region>
+	<s>d4befea37cf3ae97</s>
+</download-info>`
+
+func TestUploadAndSign(t *testing.T) {
+	var downloadInfoStatus = http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/upload-ns/file":
+			io.WriteString(w, uploadReply)
+		case "/downloadinfo-ns/3402/file":
+			w.WriteHeader(downloadInfoStatus)
+			io.WriteString(w, downloadInfoReply)
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+		}
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	info, link, err := cli.UploadAndSign(ctx, "ns", "file", 4, strings.NewReader("TEST"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "3402/file", info.Key)
+		assert.Equal(t, "http://storage-direct.hosts.net/ns/21/2/data-0.1:42968596189:2077462?ts=50b5c7ad2accf&sign=d4befea37cf3ae97", link)
+	}
+
+	downloadInfoStatus = http.StatusGone
+	info, link, err = cli.UploadAndSign(ctx, "ns", "file", 4, strings.NewReader("TEST"))
+	assert.Error(t, err)
+	assert.Empty(t, link)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, "3402/file", info.Key)
+	}
+}
@@ -0,0 +1,574 @@
+// Package mdsafero implements afero.Fs over an MDS namespace,
+// so applications built on afero can store files in MDS.
+package mdsafero
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	mds "github.com/noxiouz/mds-go"
+	"github.com/noxiouz/mds-go/mdsfs"
+	"github.com/spf13/afero"
+	"golang.org/x/net/context"
+)
+
+// ErrNotSupported is returned by operations MDS has no counterpart for, e.g. Chmod
+var ErrNotSupported = errors.New("not supported by MDS")
+
+var (
+	errIsDir    = errors.New("is a directory")
+	errNotDir   = errors.New("not a directory")
+	errReadOnly = errors.New("file is opened for reading")
+)
+
+// Option configures Fs created by New
+type Option func(*Fs)
+
+// WithContext sets a context of all requests of Fs, context.Background is used by default.
+func WithContext(ctx context.Context) Option {
+	return func(f *Fs) {
+		f.ctx = ctx
+	}
+}
+
+// Fs is afero.Fs over objects of a namespace.
+//
+// A name is a key of an object, a leading slash is ignored. A written file is uploaded
+// on Sync or Close under a filename taken from the name without a group, see mds.ParseKey,
+// and the proxy assigns a key to it. If the key differs from the name,
+// Fs remembers it, so the file is found by the name until the process exits, see Key.
+// Rewriting a file uploads it again and only then deletes the old object,
+// unless the proxy stored the new one under the same key.
+//
+// MDS has no directories and can't list objects: Mkdir and MkdirAll do nothing,
+// the root directory is always empty and RemoveAll removes only dir
+// and files written under it by this Fs.
+type Fs struct {
+	client    *mds.Client
+	files     *mdsfs.FS
+	ctx       context.Context
+	namespace string
+
+	mu sync.Mutex
+	// keys of written files which differ from their names
+	keys map[string]string
+}
+
+var _ afero.Fs = (*Fs)(nil)
+
+// New returns Fs over namespace
+func New(client *mds.Client, namespace string, opts ...Option) *Fs {
+	f := &Fs{
+		client:    client,
+		ctx:       context.Background(),
+		namespace: namespace,
+		keys:      make(map[string]string),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	f.files = mdsfs.New(client, namespace, mdsfs.WithContext(f.ctx))
+	return f
+}
+
+// cleanName turns name into a key, the root directory is an empty name
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+// uploadFilename returns a filename to upload name with, the proxy prepends a group to it
+func uploadFilename(name string) string {
+	group, filename, err := mds.ParseKey(name)
+	if err != nil || group <= 0 {
+		return name
+	}
+	return filename
+}
+
+// Key returns a key of the object stored under name
+func (f *Fs) Key(name string) string {
+	name = cleanName(name)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if key, ok := f.keys[name]; ok {
+		return key
+	}
+	return name
+}
+
+func (f *Fs) setKey(name, key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if key == name {
+		delete(f.keys, name)
+	} else {
+		f.keys[name] = key
+	}
+}
+
+// pathError translates errors of the client to ones of os
+func pathError(op, name string, err error) error {
+	switch {
+	case errors.Is(err, mds.ErrKeyNotFound):
+		err = os.ErrNotExist
+	case errors.Is(err, mds.ErrForbidden):
+		err = os.ErrPermission
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// Name implements afero.Fs
+func (f *Fs) Name() string {
+	return "MdsFs"
+}
+
+// Create implements afero.Fs
+func (f *Fs) Create(name string) (afero.File, error) {
+	return f.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// Open implements afero.Fs
+func (f *Fs) Open(name string) (afero.File, error) {
+	return f.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile implements afero.Fs. A file opened for reading only is read by Range requests,
+// otherwise it's kept in memory until Close. perm is ignored.
+func (f *Fs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	name = cleanName(name)
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		if name == "" {
+			return nil, &os.PathError{Op: "open", Path: name, Err: errIsDir}
+		}
+		return f.openWriter(name, flag)
+	}
+
+	if name == "" {
+		return &rootDir{}, nil
+	}
+	file, err := f.files.Open(f.Key(name))
+	if err != nil {
+		return nil, err
+	}
+	// files of mdsfs implement io.Seeker and io.ReaderAt
+	return &readFile{objectFile: file.(objectFile), name: name}, nil
+}
+
+func (f *Fs) openWriter(name string, flag int) (afero.File, error) {
+	exists, err := f.client.Exists(f.ctx, f.namespace, f.Key(name))
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	switch {
+	case exists && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	case !exists && flag&os.O_CREATE == 0:
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	w := &writeFile{
+		fs:      f,
+		name:    name,
+		append:  flag&os.O_APPEND != 0,
+		existed: exists,
+		dirty:   !exists || flag&os.O_TRUNC != 0,
+	}
+	if exists && flag&os.O_TRUNC == 0 {
+		w.data, err = f.client.GetFile(f.ctx, f.namespace, f.Key(name))
+		if err != nil {
+			return nil, pathError("open", name, err)
+		}
+	}
+	return w, nil
+}
+
+// store uploads data under name. If replace is set, the old object is deleted
+// after the upload, so a failed one leaves the file as it was.
+func (f *Fs) store(name string, data []byte, replace bool) error {
+	oldKey := f.Key(name)
+	info, err := f.client.Upload(f.ctx, f.namespace, uploadFilename(name), int64(len(data)), bytes.NewReader(data))
+	if err != nil {
+		return pathError("write", name, err)
+	}
+	f.setKey(name, info.Key)
+
+	if replace && info.Key != oldKey {
+		if err := f.client.DeleteIdempotent(f.ctx, f.namespace, oldKey); err != nil {
+			return pathError("write", name, err)
+		}
+	}
+	return nil
+}
+
+// Stat implements afero.Fs
+func (f *Fs) Stat(name string) (os.FileInfo, error) {
+	name = cleanName(name)
+	if name == "" {
+		return fileInfo{name: "/", dir: true}, nil
+	}
+	return f.files.Stat(f.Key(name))
+}
+
+// Remove implements afero.Fs
+func (f *Fs) Remove(name string) error {
+	name = cleanName(name)
+	if name == "" {
+		return &os.PathError{Op: "remove", Path: name, Err: errIsDir}
+	}
+	if err := f.client.Delete(f.ctx, f.namespace, f.Key(name)); err != nil {
+		return pathError("remove", name, err)
+	}
+	f.setKey(name, name)
+	return nil
+}
+
+// RemoveAll implements afero.Fs. Objects under dir can't be listed,
+// so only dir itself and files written under it by this Fs are removed.
+func (f *Fs) RemoveAll(dir string) error {
+	dir = cleanName(dir)
+	names := []string{dir}
+	f.mu.Lock()
+	for name := range f.keys {
+		if dir == "" || strings.HasPrefix(name, dir+"/") {
+			names = append(names, name)
+		}
+	}
+	f.mu.Unlock()
+
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if err := f.client.DeleteIdempotent(f.ctx, f.namespace, f.Key(name)); err != nil {
+			return pathError("removeall", name, err)
+		}
+		f.setKey(name, name)
+	}
+	return nil
+}
+
+// Rename implements afero.Fs with mds.Client.Move.
+// An object of newname is replaced: it's deleted if the moved one gets another key.
+func (f *Fs) Rename(oldname, newname string) error {
+	oldname, newname = cleanName(oldname), cleanName(newname)
+	target := f.Key(newname)
+	info, err := f.client.Move(f.ctx, f.namespace, f.Key(oldname), uploadFilename(newname))
+	if info != nil {
+		f.setKey(newname, info.Key)
+	}
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	f.setKey(oldname, oldname)
+
+	if info.Key != target {
+		if err := f.client.DeleteIdempotent(f.ctx, f.namespace, target); err != nil {
+			return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+		}
+	}
+	return nil
+}
+
+// Mkdir does nothing, directories are implicit in keys
+func (f *Fs) Mkdir(name string, perm os.FileMode) error {
+	return nil
+}
+
+// MkdirAll does nothing, directories are implicit in keys
+func (f *Fs) MkdirAll(path string, perm os.FileMode) error {
+	return nil
+}
+
+// Chmod returns ErrNotSupported
+func (f *Fs) Chmod(name string, mode os.FileMode) error {
+	return &os.PathError{Op: "chmod", Path: name, Err: ErrNotSupported}
+}
+
+// Chown returns ErrNotSupported
+func (f *Fs) Chown(name string, uid, gid int) error {
+	return &os.PathError{Op: "chown", Path: name, Err: ErrNotSupported}
+}
+
+// Chtimes returns ErrNotSupported
+func (f *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return &os.PathError{Op: "chtimes", Path: name, Err: ErrNotSupported}
+}
+
+type objectFile interface {
+	fs.File
+	io.Seeker
+	io.ReaderAt
+}
+
+// readFile is a file opened for reading
+type readFile struct {
+	objectFile
+	name string
+}
+
+func (f *readFile) Name() string {
+	return f.name
+}
+
+func (f *readFile) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: errReadOnly}
+}
+
+func (f *readFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: errReadOnly}
+}
+
+func (f *readFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *readFile) Truncate(size int64) error {
+	return &os.PathError{Op: "truncate", Path: f.name, Err: errReadOnly}
+}
+
+func (f *readFile) Sync() error {
+	return nil
+}
+
+func (f *readFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.name, Err: errNotDir}
+}
+
+func (f *readFile) Readdirnames(n int) ([]string, error) {
+	return nil, &os.PathError{Op: "readdir", Path: f.name, Err: errNotDir}
+}
+
+// writeFile is a file opened for writing, it's uploaded on Sync and Close
+type writeFile struct {
+	fs     *Fs
+	name   string
+	data   []byte
+	offset int64
+	append bool
+	// existed is set if an object is stored already, so it's replaced by an upload
+	existed bool
+	dirty   bool
+	closed  bool
+}
+
+func (w *writeFile) check(op string) error {
+	if w.closed {
+		return &os.PathError{Op: op, Path: w.name, Err: os.ErrClosed}
+	}
+	return nil
+}
+
+func (w *writeFile) Name() string {
+	return w.name
+}
+
+func (w *writeFile) Read(p []byte) (int, error) {
+	n, err := w.ReadAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+func (w *writeFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := w.check("read"); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "read", Path: w.name, Err: errors.New("negative offset")}
+	}
+	if off >= int64(len(w.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, w.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (w *writeFile) Seek(offset int64, whence int) (int64, error) {
+	if err := w.check("seek"); err != nil {
+		return 0, err
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += w.offset
+	case io.SeekEnd:
+		offset += int64(len(w.data))
+	default:
+		return 0, &os.PathError{Op: "seek", Path: w.name, Err: os.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: w.name, Err: os.ErrInvalid}
+	}
+	w.offset = offset
+	return offset, nil
+}
+
+func (w *writeFile) Write(p []byte) (int, error) {
+	if w.append {
+		w.offset = int64(len(w.data))
+	}
+	n, err := w.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
+
+func (w *writeFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := w.check("write"); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "write", Path: w.name, Err: errors.New("negative offset")}
+	}
+	if end := off + int64(len(p)); end > int64(len(w.data)) {
+		w.data = append(w.data, make([]byte, end-int64(len(w.data)))...)
+	}
+	w.dirty = true
+	return copy(w.data[off:], p), nil
+}
+
+func (w *writeFile) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *writeFile) Truncate(size int64) error {
+	if err := w.check("truncate"); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &os.PathError{Op: "truncate", Path: w.name, Err: os.ErrInvalid}
+	}
+	if size <= int64(len(w.data)) {
+		w.data = w.data[:size]
+	} else {
+		w.data = append(w.data, make([]byte, size-int64(len(w.data)))...)
+	}
+	w.dirty = true
+	return nil
+}
+
+func (w *writeFile) Stat() (os.FileInfo, error) {
+	if err := w.check("stat"); err != nil {
+		return nil, err
+	}
+	return fileInfo{name: path.Base(w.name), size: int64(len(w.data))}, nil
+}
+
+// Sync uploads the file if it's changed
+func (w *writeFile) Sync() error {
+	if err := w.check("sync"); err != nil {
+		return err
+	}
+	if !w.dirty {
+		return nil
+	}
+	if err := w.fs.store(w.name, w.data, w.existed); err != nil {
+		return err
+	}
+	w.existed, w.dirty = true, false
+	return nil
+}
+
+func (w *writeFile) Close() error {
+	err := w.Sync()
+	w.closed = true
+	return err
+}
+
+func (w *writeFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: w.name, Err: errNotDir}
+}
+
+func (w *writeFile) Readdirnames(n int) ([]string, error) {
+	return nil, &os.PathError{Op: "readdir", Path: w.name, Err: errNotDir}
+}
+
+// rootDir is the root directory, it's empty since objects can't be listed
+type rootDir struct{}
+
+func (d *rootDir) Name() string {
+	return "/"
+}
+
+func (d *rootDir) Read(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: "/", Err: errIsDir}
+}
+
+func (d *rootDir) ReadAt(p []byte, off int64) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: "/", Err: errIsDir}
+}
+
+func (d *rootDir) Seek(offset int64, whence int) (int64, error) {
+	return 0, &os.PathError{Op: "seek", Path: "/", Err: errIsDir}
+}
+
+func (d *rootDir) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: "/", Err: errIsDir}
+}
+
+func (d *rootDir) WriteAt(p []byte, off int64) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: "/", Err: errIsDir}
+}
+
+func (d *rootDir) WriteString(s string) (int, error) {
+	return d.Write([]byte(s))
+}
+
+func (d *rootDir) Truncate(size int64) error {
+	return &os.PathError{Op: "truncate", Path: "/", Err: errIsDir}
+}
+
+func (d *rootDir) Readdir(count int) ([]os.FileInfo, error) {
+	if count > 0 {
+		return nil, io.EOF
+	}
+	return nil, nil
+}
+
+func (d *rootDir) Readdirnames(n int) ([]string, error) {
+	if n > 0 {
+		return nil, io.EOF
+	}
+	return nil, nil
+}
+
+func (d *rootDir) Stat() (os.FileInfo, error) {
+	return fileInfo{name: "/", dir: true}, nil
+}
+
+func (d *rootDir) Sync() error {
+	return nil
+}
+
+func (d *rootDir) Close() error {
+	return nil
+}
+
+// fileInfo describes a file opened for writing or the root directory
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) ModTime() time.Time { return time.Time{} }
+func (i fileInfo) IsDir() bool        { return i.dir }
+func (i fileInfo) Sys() interface{}   { return nil }
+
+func (i fileInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
@@ -0,0 +1,274 @@
+package mdsafero
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mds "github.com/noxiouz/mds-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// store is a proxy keeping objects in memory, uploads get group 1
+// and replace objects of the same filename
+type store struct {
+	*httptest.Server
+	mu      sync.Mutex
+	objects map[string][]byte
+	// failUploads makes uploads fail with 500
+	failUploads bool
+	// groups makes every upload get the next group, so keys never repeat
+	groups int
+}
+
+func newStore() *store {
+	s := &store{objects: make(map[string][]byte)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+		if len(parts) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		switch handle, name := parts[0], parts[1]; handle {
+		case "upload-ns":
+			if s.failUploads {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			key := "1/" + name
+			if s.groups > 0 {
+				s.groups++
+				key = fmt.Sprintf("%d/%s", s.groups, name)
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			s.objects[key] = body
+			fmt.Fprintf(w, `<post obj="ns.%s" id="0:1" groups="2" size="%d" key="%s"><written>2</written></post>`, name, len(body), key)
+		case "get-ns":
+			body, ok := s.objects[name]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+		case "delete-ns":
+			if _, ok := s.objects[name]; !ok {
+				http.NotFound(w, r)
+				return
+			}
+			delete(s.objects, name)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return s
+}
+
+func (s *store) object(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body, ok := s.objects[key]
+	return string(body), ok
+}
+
+func newTestFs(t *testing.T, srv *httptest.Server) *Fs {
+	u, err := url.Parse(srv.URL)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	port, err := strconv.Atoi(u.Port())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cli, err := mds.New(u.Hostname(), mds.WithPorts(port, port))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return New(cli, "ns")
+}
+
+func TestFs(t *testing.T) {
+	srv := newStore()
+	defer srv.Close()
+	fsys := newTestFs(t, srv.Server)
+
+	assert.NoError(t, fsys.MkdirAll("/reports", 0755))
+	f, err := fsys.Create("/reports/a.csv")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, err = f.WriteString("TESTBLOB")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	// the proxy assigned a group, but the file is found by its name
+	assert.Equal(t, "1/reports/a.csv", fsys.Key("reports/a.csv"))
+	body, ok := srv.object("1/reports/a.csv")
+	assert.True(t, ok)
+	assert.Equal(t, "TESTBLOB", body)
+
+	info, err := fsys.Stat("reports/a.csv")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "a.csv", info.Name())
+		assert.Equal(t, int64(8), info.Size())
+	}
+
+	f, err = fsys.Open("/reports/a.csv")
+	if assert.NoError(t, err) {
+		_, err = f.Seek(4, io.SeekStart)
+		assert.NoError(t, err)
+		data, err := ioutil.ReadAll(f)
+		assert.NoError(t, err)
+		assert.Equal(t, "BLOB", string(data))
+		_, err = f.Write([]byte("x"))
+		assert.Error(t, err)
+		assert.NoError(t, f.Close())
+	}
+
+	// rewriting replaces the object
+	f, err = fsys.OpenFile("reports/a.csv", os.O_WRONLY|os.O_APPEND, 0)
+	if assert.NoError(t, err) {
+		_, err = f.WriteString("!")
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+	}
+	body, _ = srv.object("1/reports/a.csv")
+	assert.Equal(t, "TESTBLOB!", body)
+
+	_, err = fsys.OpenFile("reports/a.csv", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	assert.True(t, errors.Is(err, os.ErrExist), "%v", err)
+	_, err = fsys.OpenFile("reports/b.csv", os.O_WRONLY, 0)
+	assert.True(t, errors.Is(err, os.ErrNotExist), "%v", err)
+
+	assert.NoError(t, fsys.Rename("reports/a.csv", "reports/b.csv"))
+	_, err = fsys.Stat("reports/a.csv")
+	assert.True(t, errors.Is(err, os.ErrNotExist), "%v", err)
+	body, ok = srv.object("1/reports/b.csv")
+	assert.True(t, ok)
+	assert.Equal(t, "TESTBLOB!", body)
+
+	assert.NoError(t, fsys.Remove("reports/b.csv"))
+	_, err = fsys.Open("reports/b.csv")
+	assert.True(t, errors.Is(err, os.ErrNotExist), "%v", err)
+	assert.True(t, errors.Is(fsys.Remove("reports/b.csv"), os.ErrNotExist))
+
+	assert.True(t, errors.Is(fsys.Chmod("reports/b.csv", 0600), ErrNotSupported))
+}
+
+func TestFsRemoveAll(t *testing.T) {
+	srv := newStore()
+	defer srv.Close()
+	fsys := newTestFs(t, srv.Server)
+
+	for _, name := range []string{"dir/a", "dir/sub/b", "other"} {
+		f, err := fsys.Create(name)
+		if assert.NoError(t, err) {
+			assert.NoError(t, f.Close())
+		}
+	}
+	assert.NoError(t, fsys.RemoveAll("dir"))
+	assert.NoError(t, fsys.RemoveAll("missing"))
+
+	srv.mu.Lock()
+	assert.Len(t, srv.objects, 1)
+	assert.Contains(t, srv.objects, "1/other")
+	srv.mu.Unlock()
+}
+
+func TestWriteFile(t *testing.T) {
+	srv := newStore()
+	defer srv.Close()
+
+	f, err := newTestFs(t, srv.Server).Create("1/file")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, err = f.WriteAt([]byte("BLOB"), 4)
+	assert.NoError(t, err)
+	_, err = f.Write([]byte("TEST"))
+	assert.NoError(t, err)
+	assert.NoError(t, f.Truncate(6))
+
+	buf := make([]byte, 8)
+	n, err := f.ReadAt(buf, 0)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "TESTBL", string(buf[:n]))
+
+	assert.NoError(t, f.Sync())
+	body, ok := srv.object("1/file")
+	assert.True(t, ok)
+	assert.Equal(t, "TESTBL", body)
+
+	// nothing changed since Sync
+	assert.NoError(t, f.Close())
+	_, err = f.Write([]byte("x"))
+	assert.True(t, errors.Is(err, os.ErrClosed), "%v", err)
+}
+
+func TestFsRewriteFailure(t *testing.T) {
+	srv := newStore()
+	defer srv.Close()
+	fsys := newTestFs(t, srv.Server)
+
+	f, err := fsys.Create("file")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	f.WriteString("TESTBLOB")
+	assert.NoError(t, f.Close())
+
+	srv.mu.Lock()
+	srv.failUploads = true
+	srv.mu.Unlock()
+
+	f, err = fsys.Create("file")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	f.WriteString("new")
+	assert.Error(t, f.Close())
+
+	// the old content is kept
+	body, ok := srv.object("1/file")
+	assert.True(t, ok)
+	assert.Equal(t, "TESTBLOB", body)
+	assert.Equal(t, "1/file", fsys.Key("file"))
+}
+
+func TestFsRenameOverExisting(t *testing.T) {
+	srv := newStore()
+	srv.groups = 1
+	defer srv.Close()
+	fsys := newTestFs(t, srv.Server)
+
+	for _, name := range []string{"a", "b"} {
+		f, err := fsys.Create(name)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		f.WriteString(name)
+		assert.NoError(t, f.Close())
+	}
+	assert.Equal(t, "3/b", fsys.Key("b"))
+
+	assert.NoError(t, fsys.Rename("a", "b"))
+	assert.Equal(t, "4/b", fsys.Key("b"))
+
+	// neither the source nor the old target is left
+	srv.mu.Lock()
+	assert.Equal(t, map[string][]byte{"4/b": []byte("a")}, srv.objects)
+	srv.mu.Unlock()
+}
@@ -0,0 +1,218 @@
+// Package mdsfs exposes objects of an MDS namespace as a read-only io/fs.FS,
+// e.g. for http.FS or template.ParseFS.
+package mdsfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+
+	mds "github.com/noxiouz/mds-go"
+	"golang.org/x/net/context"
+)
+
+// Option configures FS created by New
+type Option func(*FS)
+
+// WithPrefix makes FS read names relative to prefix,
+// e.g. "index.html" is read as key "123/site/index.html" with prefix "123/site".
+func WithPrefix(prefix string) Option {
+	return func(f *FS) {
+		f.prefix = prefix
+	}
+}
+
+// WithContext sets a context of all requests of FS, context.Background is used by default.
+func WithContext(ctx context.Context) Option {
+	return func(f *FS) {
+		f.ctx = ctx
+	}
+}
+
+// FS is a read-only fs.FS over objects of a namespace, a name is a key of an object.
+// It implements fs.StatFS and fs.ReadFileFS as well.
+// MDS can't list objects, so the root directory is always empty
+// and other directories don't exist: fs.WalkDir and fs.Glob with wildcards find nothing,
+// but names without them work, e.g. template.ParseFS(fsys, "index.html").
+type FS struct {
+	client    *mds.Client
+	ctx       context.Context
+	namespace string
+	prefix    string
+}
+
+// New returns FS over namespace
+func New(client *mds.Client, namespace string, opts ...Option) *FS {
+	f := &FS{
+		client:    client,
+		ctx:       context.Background(),
+		namespace: namespace,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+func (f *FS) key(name string) string {
+	if f.prefix == "" {
+		return name
+	}
+	return path.Join(f.prefix, name)
+}
+
+// Open implements fs.FS. A returned file implements io.Seeker and io.ReaderAt
+// by Range requests. An object without Range support is read into memory.
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &rootDir{}, nil
+	}
+
+	rd, err := f.client.OpenReader(f.ctx, f.namespace, f.key(name))
+	if err == nil {
+		return &file{
+			readSeekReaderAt: rd,
+			closer:           rd,
+			info:             newFileInfo(name, rd.Info(), rd.Size()),
+		}, nil
+	}
+	if !errors.Is(err, mds.ErrRangesNotSupported) {
+		return nil, pathError("open", name, err)
+	}
+
+	info, err := f.client.Stat(f.ctx, f.namespace, f.key(name))
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	body, err := f.client.GetFile(f.ctx, f.namespace, f.key(name))
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return &file{
+		readSeekReaderAt: bytes.NewReader(body),
+		info:             newFileInfo(name, info, int64(len(body))),
+	}, nil
+}
+
+// Stat implements fs.StatFS with a single HEAD request
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return rootInfo{}, nil
+	}
+
+	info, err := f.client.Stat(f.ctx, f.namespace, f.key(name))
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return newFileInfo(name, info, info.Size), nil
+}
+
+// ReadFile implements fs.ReadFileFS with a single GET request
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+
+	body, err := f.client.GetFile(f.ctx, f.namespace, f.key(name))
+	if err != nil {
+		return nil, pathError("read", name, err)
+	}
+	return body, nil
+}
+
+// pathError translates errors of the client to ones of io/fs
+func pathError(op, name string, err error) error {
+	switch {
+	case errors.Is(err, mds.ErrKeyNotFound):
+		err = fs.ErrNotExist
+	case errors.Is(err, mds.ErrForbidden):
+		err = fs.ErrPermission
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+var errIsDir = errors.New("is a directory")
+
+type readSeekReaderAt interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+type file struct {
+	readSeekReaderAt
+	// closer is nil for an object read into memory
+	closer io.Closer
+	info   fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Close() error {
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer.Close()
+}
+
+// fileInfo describes an object, Sys returns its *mds.ObjectInfo
+type fileInfo struct {
+	name string
+	size int64
+	info *mds.ObjectInfo
+}
+
+func newFileInfo(name string, info *mds.ObjectInfo, size int64) fileInfo {
+	return fileInfo{name: path.Base(name), size: size, info: info}
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) Mode() fs.FileMode  { return 0444 }
+func (i fileInfo) ModTime() time.Time { return i.info.LastModified }
+func (i fileInfo) IsDir() bool        { return false }
+func (i fileInfo) Sys() interface{}   { return i.info }
+
+// rootDir is the root directory, it's empty since objects can't be listed
+type rootDir struct{}
+
+func (d *rootDir) Stat() (fs.FileInfo, error) {
+	return rootInfo{}, nil
+}
+
+func (d *rootDir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: errIsDir}
+}
+
+func (d *rootDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n > 0 {
+		return nil, io.EOF
+	}
+	return nil, nil
+}
+
+func (d *rootDir) Close() error {
+	return nil
+}
+
+type rootInfo struct{}
+
+func (rootInfo) Name() string       { return "." }
+func (rootInfo) Size() int64        { return 0 }
+func (rootInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (rootInfo) ModTime() time.Time { return time.Time{} }
+func (rootInfo) IsDir() bool        { return true }
+func (rootInfo) Sys() interface{}   { return nil }
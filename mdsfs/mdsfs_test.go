@@ -0,0 +1,157 @@
+package mdsfs
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	mds "github.com/noxiouz/mds-go"
+	"github.com/stretchr/testify/assert"
+)
+
+var modTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// newServer serves objects of namespace ns by their keys
+func newServer(objects map[string]string, ranges bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := objects[strings.TrimPrefix(r.URL.Path, "/get-ns/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if !ranges {
+			w.Write([]byte(body))
+			return
+		}
+		http.ServeContent(w, r, "", modTime, strings.NewReader(body))
+	}))
+}
+
+func newTestFS(t *testing.T, srv *httptest.Server, opts ...Option) *FS {
+	u, err := url.Parse(srv.URL)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	port, err := strconv.Atoi(u.Port())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cli, err := mds.New(u.Hostname(), mds.WithPorts(port, port))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return New(cli, "ns", opts...)
+}
+
+func TestFS(t *testing.T) {
+	srv := newServer(map[string]string{
+		"1/site/index.html": "<h1>{{.}}</h1>",
+		"1/site/data.bin":   "TESTBLOB",
+	}, true)
+	defer srv.Close()
+
+	fsys := newTestFS(t, srv, WithPrefix("1/site"))
+	assert.NoError(t, fstest.TestFS(fsys))
+
+	body, err := fs.ReadFile(fsys, "data.bin")
+	assert.NoError(t, err)
+	assert.Equal(t, "TESTBLOB", string(body))
+
+	info, err := fs.Stat(fsys, "data.bin")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "data.bin", info.Name())
+		assert.Equal(t, int64(8), info.Size())
+		assert.True(t, info.ModTime().Equal(modTime))
+		assert.False(t, info.IsDir())
+	}
+
+	f, err := fsys.Open("data.bin")
+	if assert.NoError(t, err) {
+		rs := f.(io.ReadSeeker)
+		_, err = rs.Seek(4, io.SeekStart)
+		assert.NoError(t, err)
+		body, err = ioutil.ReadAll(rs)
+		assert.NoError(t, err)
+		assert.Equal(t, "BLOB", string(body))
+
+		buf := make([]byte, 3)
+		_, err = f.(io.ReaderAt).ReadAt(buf, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, "EST", string(buf))
+		assert.NoError(t, f.Close())
+	}
+
+	tmpl, err := template.ParseFS(fsys, "index.html")
+	if assert.NoError(t, err) {
+		var out bytes.Buffer
+		assert.NoError(t, tmpl.Execute(&out, "hello"))
+		assert.Equal(t, "<h1>hello</h1>", out.String())
+	}
+
+	for _, name := range []string{"missing", "1/site/data.bin"} {
+		_, err = fsys.Open(name)
+		assert.True(t, errors.Is(err, fs.ErrNotExist), "%s: %v", name, err)
+		_, err = fs.Stat(fsys, name)
+		assert.True(t, errors.Is(err, fs.ErrNotExist), "%s: %v", name, err)
+		_, err = fs.ReadFile(fsys, name)
+		assert.True(t, errors.Is(err, fs.ErrNotExist), "%s: %v", name, err)
+	}
+	for _, name := range []string{"/data.bin", "../data.bin", "data.bin/"} {
+		_, err = fsys.Open(name)
+		assert.True(t, errors.Is(err, fs.ErrInvalid), "%s: %v", name, err)
+	}
+}
+
+func TestFSHTTP(t *testing.T) {
+	srv := newServer(map[string]string{"1/data.bin": "TESTBLOB"}, true)
+	defer srv.Close()
+
+	files := httptest.NewServer(http.FileServer(http.FS(newTestFS(t, srv))))
+	defer files.Close()
+
+	req, err := http.NewRequest("GET", files.URL+"/1/data.bin", nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	req.Header.Set("Range", "bytes=2-5")
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "STBL", string(body))
+}
+
+func TestFSWithoutRanges(t *testing.T) {
+	srv := newServer(map[string]string{"1/data.bin": "TESTBLOB"}, false)
+	defer srv.Close()
+
+	f, err := newTestFS(t, srv).Open("1/data.bin")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), info.Size())
+	_, err = f.(io.Seeker).Seek(4, io.SeekStart)
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "BLOB", string(body))
+}
@@ -0,0 +1,165 @@
+package mds
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// MemCache is a Cache keeping entries in memory, which suits small hot objects.
+// The least recently used entries are evicted when the total size exceeds a limit.
+type MemCache struct {
+	maxSize int64
+
+	mu   sync.Mutex
+	size int64
+	// gen is bumped by Remove and Flush, see FSCache
+	gen     uint64
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type memCacheEntry struct {
+	key    string
+	header http.Header
+	body   []byte
+}
+
+// NewMemCache creates a cache limited by maxSize bytes
+func NewMemCache(maxSize int64) *MemCache {
+	return &MemCache{
+		maxSize: maxSize,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Get implements Cache
+func (c *MemCache) Get(key string) (*CacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+
+	entry := elem.Value.(*memCacheEntry)
+	return &CacheEntry{
+		ETag:   entry.header.Get("ETag"),
+		Header: cacheHeader(entry.header),
+		Size:   int64(len(entry.body)),
+		Body:   ioutil.NopCloser(bytes.NewReader(entry.body)),
+	}, true
+}
+
+// Put implements Cache
+func (c *MemCache) Put(key string, header http.Header) (CacheWriter, error) {
+	c.mu.Lock()
+	gen := c.gen
+	c.mu.Unlock()
+
+	return &memCacheWriter{
+		cache: c,
+		entry: memCacheEntry{key: key, header: cacheHeader(header)},
+		gen:   gen,
+	}, nil
+}
+
+// Remove implements Cache.
+// Bodies being stored concurrently are discarded on Commit.
+func (c *MemCache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+}
+
+// Flush implements CacheFlusher.
+// Bodies being stored concurrently are discarded on Commit.
+func (c *MemCache) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.size = 0
+	return nil
+}
+
+// Size returns the total size of cached entries.
+func (c *MemCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *MemCache) commit(entry *memCacheEntry, gen uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+	if elem, ok := c.entries[entry.key]; ok {
+		c.remove(elem)
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.size += int64(len(entry.body))
+	c.evict()
+}
+
+// remove must be called with mu held
+func (c *MemCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*memCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.body))
+}
+
+// evict must be called with mu held
+func (c *MemCache) evict() {
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+type memCacheWriter struct {
+	cache *MemCache
+	entry memCacheEntry
+	gen   uint64
+	// tooLarge is set once the body exceeds maxSize, it's never committed
+	tooLarge bool
+}
+
+// Write fails once the body exceeds the size of the cache,
+// so a large object isn't buffered only to be evicted.
+func (w *memCacheWriter) Write(p []byte) (int, error) {
+	if w.tooLarge || int64(len(w.entry.body)+len(p)) > w.cache.maxSize {
+		w.tooLarge = true
+		w.entry.body = nil
+		return 0, fmt.Errorf("cache entry %s exceeds cache size %d", w.entry.key, w.cache.maxSize)
+	}
+	w.entry.body = append(w.entry.body, p...)
+	return len(p), nil
+}
+
+func (w *memCacheWriter) Commit() error {
+	if w.tooLarge {
+		return fmt.Errorf("cache entry %s exceeds cache size %d", w.entry.key, w.cache.maxSize)
+	}
+	w.cache.commit(&w.entry, w.gen)
+	return nil
+}
+
+func (w *memCacheWriter) Abort() error {
+	w.entry.body = nil
+	return nil
+}
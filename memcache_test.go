@@ -0,0 +1,125 @@
+package mds
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestMemCache(t *testing.T) {
+	c := NewMemCache(10)
+
+	_, _, ok := readCache(t, c, "ns/1/a")
+	assert.False(t, ok)
+
+	putCache(t, c, "ns/1/a", `"a"`, "aaaa")
+	putCache(t, c, "ns/1/b", "", "bbbb")
+
+	body, etag, ok := readCache(t, c, "ns/1/a")
+	assert.True(t, ok)
+	assert.Equal(t, "aaaa", body)
+	assert.Equal(t, `"a"`, etag)
+	assert.Equal(t, int64(8), c.Size())
+
+	// b is the least recently used one
+	putCache(t, c, "ns/1/c", "", "cccc")
+	_, _, ok = readCache(t, c, "ns/1/b")
+	assert.False(t, ok)
+	assert.Equal(t, int64(8), c.Size())
+
+	w, err := c.Put("ns/1/d", nil)
+	if assert.NoError(t, err) {
+		w.Write([]byte("dd"))
+		assert.NoError(t, w.Abort())
+	}
+	_, _, ok = readCache(t, c, "ns/1/d")
+	assert.False(t, ok)
+
+	c.Remove("ns/1/c")
+	_, _, ok = readCache(t, c, "ns/1/c")
+	assert.False(t, ok)
+
+	// a body larger than the cache isn't buffered
+	w, err = c.Put("ns/1/e", nil)
+	if assert.NoError(t, err) {
+		_, err = w.Write([]byte("eeeeee"))
+		assert.NoError(t, err)
+		_, err = w.Write([]byte("eeeeee"))
+		assert.Error(t, err)
+		assert.Error(t, w.Commit())
+	}
+	_, _, ok = readCache(t, c, "ns/1/e")
+	assert.False(t, ok)
+
+	assert.NoError(t, c.Flush())
+	_, _, ok = readCache(t, c, "ns/1/a")
+	assert.False(t, ok)
+	assert.Equal(t, int64(0), c.Size())
+}
+
+func TestGetCoalescesMisses(t *testing.T) {
+	const readers = 10
+	var requests int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("TESTBLOB"))
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	cli.Cache = NewMemCache(1 << 20)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body, err := cli.GetFile(ctx, "ns", "1/key")
+			assert.NoError(t, err)
+			assert.Equal(t, "TESTBLOB", string(body))
+		}()
+	}
+	// let every reader reach the cache before the reply
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestGetWhileHoldingBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("TEST"))
+		// an unknown length makes the body streamed
+		w.(http.Flusher).Flush()
+		w.Write([]byte("BLOB"))
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	cli.Cache = NewMemCache(1 << 20)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	rd, err := cli.Get(ctx, "ns", "1/key")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer rd.Close()
+
+	// the same goroutine must not wait for the body it holds
+	body, err := cli.GetFile(ctx, "ns", "1/key")
+	assert.NoError(t, err)
+	assert.Equal(t, "TESTBLOB", string(body))
+}
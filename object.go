@@ -0,0 +1,168 @@
+package mds
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	// Size is a length of the returned content or -1 if it's unknown.
+	Size        int64
+	ContentType string
+	// LastModified is parsed from Last-Modified header.
+	// It's zero if the header is missing or malformed, see ModTime.
+	LastModified time.Time
+	// Expires is parsed from Expires header, it's zero if the proxy doesn't report it.
+	Expires time.Time
+	// ETag identifies a version of the object, e.g. for GetRangeIf.
+	ETag string
+	// CacheControl is Cache-Control header of a reply of the proxy, if any.
+	CacheControl string
+	// RangesSupported reports whether the proxy accepts byte ranges for the object,
+	// which is announced with Accept-Ranges header.
+	RangesSupported bool
+}
+
+// ModTime returns LastModified and whether it was reported by the proxy.
+func (i *ObjectInfo) ModTime() (time.Time, bool) {
+	return i.LastModified, !i.LastModified.IsZero()
+}
+
+func newObjectInfo(resp *http.Response) ObjectInfo {
+	// a malformed value leaves zero time
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	expires, _ := http.ParseTime(resp.Header.Get("Expires"))
+	return ObjectInfo{
+		Size:            resp.ContentLength,
+		ContentType:     resp.Header.Get("Content-Type"),
+		LastModified:    modTime,
+		Expires:         expires,
+		ETag:            resp.Header.Get("ETag"),
+		CacheControl:    resp.Header.Get("Cache-Control"),
+		RangesSupported: acceptsRanges(resp),
+	}
+}
+
+func acceptsRanges(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusPartialContent {
+		return true
+	}
+	for _, unit := range strings.Split(resp.Header.Get("Accept-Ranges"), ",") {
+		if strings.TrimSpace(unit) == "bytes" {
+			return true
+		}
+	}
+	return false
+}
+
+// Object is a body of a stored object along with its metadata
+type Object struct {
+	ObjectInfo
+
+	Body io.ReadCloser
+}
+
+// OpenObject is like Get, but also returns metadata of the object
+// captured from the same response, so it takes a single round trip.
+// User is responsible for closing Body.
+func (m *Client) OpenObject(ctx context.Context, namespace, key string, Range ...uint64) (*Object, error) {
+	resp, err := m.get(ctx, namespace, key, Range...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Object{
+		ObjectInfo: newObjectInfo(resp),
+		Body:       resp.Body,
+	}, nil
+}
+
+// Touch reads key and discards its body, so the connection is reused.
+// It bypasses Cache, so the result reflects the proxy.
+// A missing key results in an error matching ErrKeyNotFound with errors.Is.
+func (m *Client) Touch(ctx context.Context, namespace, key string) error {
+	urlStr := m.readURL(ctx, namespace, key)
+	req, err := m.newRequest(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := ctxhttp.Do(ctx, m.client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if !m.success("touch", resp.StatusCode) {
+		scope := ErrorMethodScope{
+			Method:    "touch",
+			URL:       urlStr,
+			Namespace: namespace,
+			Key:       key,
+		}
+		return newMethodError(scope, resp)
+	}
+
+	_, err = io.Copy(ioutil.Discard, &resetClassifyingBody{resp.Body})
+	return err
+}
+
+// Exists checks whether key is stored with a HEAD request, so no body is transferred.
+// A missing key is not an error.
+func (m *Client) Exists(ctx context.Context, namespace, key string) (bool, error) {
+	_, err := m.Stat(ctx, namespace, key)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, ErrKeyNotFound):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// Stat returns metadata of key with a HEAD request, so no body is transferred.
+// A missing key results in an error matching ErrKeyNotFound with errors.Is.
+func (m *Client) Stat(ctx context.Context, namespace, key string) (*ObjectInfo, error) {
+	var info *ObjectInfo
+	err := m.retry(ctx, func() (err error) {
+		info, err = m.stat(ctx, namespace, key)
+		return err
+	})
+	return info, err
+}
+
+func (m *Client) stat(ctx context.Context, namespace, key string) (*ObjectInfo, error) {
+	urlStr := m.readURL(ctx, namespace, key)
+	req, err := m.newRequest(ctx, "HEAD", urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := ctxhttp.Do(ctx, m.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !m.success("stat", resp.StatusCode) {
+		scope := ErrorMethodScope{
+			Method:    "stat",
+			URL:       urlStr,
+			Namespace: namespace,
+			Key:       key,
+		}
+		return nil, newMethodError(scope, resp)
+	}
+
+	info := newObjectInfo(resp)
+	return &info, nil
+}
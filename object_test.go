@@ -0,0 +1,223 @@
+package mds
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestOpenObject(t *testing.T) {
+	const body = "TESTBLOB"
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/get-ns/1/key", r.URL.Path)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(body))
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	obj, err := cli.OpenObject(ctx, "ns", "1/key")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, int64(len(body)), obj.Size)
+	assert.Equal(t, "text/plain", obj.ContentType)
+	assert.Equal(t, "public, max-age=3600", obj.CacheControl)
+	data, err := ioutil.ReadAll(obj.Body)
+	obj.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(data))
+
+	obj, err = cli.OpenObject(ctx, "ns", "1/key", 2, 4)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, int64(3), obj.Size)
+	obj.Body.Close()
+
+	assert.Equal(t, 2, requests)
+}
+
+func TestOpenObjectNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	_, err := cli.OpenObject(context.Background(), "ns", "1/key")
+	mErr, ok := err.(MethodError)
+	if assert.True(t, ok) {
+		assert.Equal(t, "404 Not Found", mErr.Status)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	var conns int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/get-ns/1/key" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(bytes.Repeat([]byte("x"), 64<<10))
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, cli.Touch(ctx, "ns", "1/key"))
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns))
+
+	assert.True(t, errors.Is(cli.Touch(ctx, "ns", "1/missing"), ErrKeyNotFound))
+}
+
+func TestExists(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "HEAD", r.Method)
+		switch r.URL.Path {
+		case "/get-ns/1/key":
+			w.Write([]byte("TESTBLOB"))
+		case "/get-ns/1/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	exists, err := cli.Exists(ctx, "ns", "1/key")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = cli.Exists(ctx, "ns", "1/missing")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = cli.Exists(ctx, "ns", "1/forbidden")
+	assert.True(t, errors.Is(err, ErrForbidden))
+}
+
+func TestStat(t *testing.T) {
+	modTime := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	expires := modTime.Add(24 * time.Hour)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "HEAD", r.Method)
+		if r.URL.Path != "/get-ns/1/key" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+		w.Header().Set("Expires", expires.Format(http.TimeFormat))
+		w.Write([]byte("TESTBLOB"))
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	info, err := cli.Stat(ctx, "ns", "1/key")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(8), info.Size)
+		assert.Equal(t, "text/plain", info.ContentType)
+		assert.True(t, modTime.Equal(info.LastModified))
+		assert.True(t, expires.Equal(info.Expires))
+	}
+
+	_, err = cli.Stat(ctx, "ns", "1/missing")
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+}
+
+func TestObjectInfoRangesSupported(t *testing.T) {
+	var acceptRanges string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if acceptRanges != "" {
+			w.Header().Set("Accept-Ranges", acceptRanges)
+		}
+		w.Write([]byte("TESTBLOB"))
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		header   string
+		expected bool
+	}{
+		{"bytes", true},
+		{"none, bytes", true},
+		{"", false},
+		{"none", false},
+	} {
+		acceptRanges = tc.header
+		obj, err := cli.OpenObject(ctx, "ns", "1/key")
+		if assert.NoError(t, err) {
+			obj.Body.Close()
+			assert.Equal(t, tc.expected, obj.RangesSupported, tc.header)
+		}
+
+		info, err := cli.stat(ctx, "ns", "1/key")
+		if assert.NoError(t, err) {
+			assert.Equal(t, tc.expected, info.RangesSupported, tc.header)
+		}
+	}
+}
+
+func TestObjectInfoLastModified(t *testing.T) {
+	var lastModified string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lastModified != "" {
+			w.Header().Set("Last-Modified", lastModified)
+		}
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		header   string
+		expected time.Time
+	}{
+		{"Mon, 29 Dec 2014 15:25:09 GMT", time.Date(2014, time.December, 29, 15, 25, 9, 0, time.UTC)},
+		{"", time.Time{}},
+		{"yesterday", time.Time{}},
+	} {
+		lastModified = tc.header
+		obj, err := cli.OpenObject(ctx, "ns", "1/key")
+		if !assert.NoError(t, err) {
+			continue
+		}
+		obj.Body.Close()
+
+		modTime, ok := obj.ModTime()
+		assert.Equal(t, !tc.expected.IsZero(), ok, tc.header)
+		assert.True(t, tc.expected.Equal(modTime), tc.header)
+	}
+}
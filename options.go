@@ -0,0 +1,122 @@
+package mds
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// Option configures a client created by New
+type Option func(*settings)
+
+type settings struct {
+	config Config
+	client *http.Client
+	clock  Clock
+}
+
+// New creates a client to MDS proxy at host, which may include a scheme,
+// http is used by default. Ports must be set with WithPorts.
+// Options are applied in order, so a later one wins.
+func New(host string, opts ...Option) (*Client, error) {
+	s := settings{
+		config: Config{Host: host},
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	cli, err := newClient(s.config, s.client)
+	if err != nil {
+		return nil, err
+	}
+	if s.clock != nil {
+		cli.setClock(s.clock)
+	}
+	return cli, nil
+}
+
+// WithClock replaces the real time used by retries, circuit breakers and WaitDeleted,
+// so tests drive their timing deterministically.
+func WithClock(c Clock) Option {
+	return func(s *settings) {
+		s.clock = c
+	}
+}
+
+// WithPorts sets ports of the proxy to upload and read objects
+func WithPorts(upload, read int) Option {
+	return func(s *settings) {
+		s.config.UploadPort = upload
+		s.config.ReadPort = read
+	}
+}
+
+// WithHosts sets Config.Hosts, so requests rotate across hosts
+// instead of the one passed to New.
+func WithHosts(hosts ...string) Option {
+	return func(s *settings) {
+		s.config.Hosts = hosts
+	}
+}
+
+// WithDeleteEndpoint sets Config.DeleteHost and Config.DeletePort
+func WithDeleteEndpoint(host string, port int) Option {
+	return func(s *settings) {
+		s.config.DeleteHost = host
+		s.config.DeletePort = port
+	}
+}
+
+// WithAuthorization sets a complete value of Authorization header sent with every request.
+// See WithAuthHeader to override it for a single request.
+func WithAuthorization(header string) Option {
+	return func(s *settings) {
+		s.config.AuthHeader = header
+	}
+}
+
+// WithToken makes the client assemble Authorization header from scheme and token,
+// see AuthorizationHeader.
+func WithToken(scheme, token string) Option {
+	return func(s *settings) {
+		s.config.AuthScheme = scheme
+		s.config.AuthToken = token
+	}
+}
+
+// WithHTTPClient makes the client send requests with client.
+// NewTransport defaults are used if it's not set.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *settings) {
+		s.client = client
+	}
+}
+
+// WithTransport sets Config.Transport
+func WithTransport(transport http.RoundTripper) Option {
+	return func(s *settings) {
+		s.config.Transport = transport
+	}
+}
+
+// WithTLS makes the client use https for hosts without a scheme
+// and sets Config.TLSConfig, which may be nil to keep defaults.
+func WithTLS(config *tls.Config) Option {
+	return func(s *settings) {
+		s.config.UseTLS = true
+		s.config.TLSConfig = config
+	}
+}
+
+// WithCache sets Config.Cache
+func WithCache(cache Cache) Option {
+	return func(s *settings) {
+		s.config.Cache = cache
+	}
+}
+
+// WithConfig lets fn adjust any Config field, which has no dedicated option
+func WithConfig(fn func(*Config)) Option {
+	return func(s *settings) {
+		fn(&s.config)
+	}
+}
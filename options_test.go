@@ -0,0 +1,44 @@
+package mds
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestNew(t *testing.T) {
+	var auth []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+
+	port := serverPort(t, srv)
+	cli, err := New("127.0.0.1",
+		WithPorts(port, port),
+		WithToken(SchemeOAuth, "token"),
+		WithConfig(func(c *Config) { c.DeleteMode, c.SoftDeleteQuery = SoftDelete, "tombstone=yes" }),
+	)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "http://127.0.0.1", cli.Host)
+	assert.Equal(t, SoftDelete, cli.DeleteMode)
+
+	ctx := context.Background()
+	assert.NoError(t, cli.Ping(ctx))
+	assert.Equal(t, []string{"OAuth token"}, auth)
+
+	cli, err = New("127.0.0.1", WithPorts(1111, 80), WithDeleteEndpoint("delete.proxy.net", 8080))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "http://delete.proxy.net:8080/delete-ns/1/key", cli.deleteURL(ctx, "ns", "1/key", HardDelete))
+	}
+
+	_, err = New("127.0.0.1", WithAuthorization("Basic dGVzdDp0ZXN0"), WithToken(SchemeOAuth, "token"))
+	assert.Error(t, err)
+	_, err = New("127.0.0.1", WithHTTPClient(&http.Client{}), WithTransport(http.DefaultTransport))
+	assert.Error(t, err)
+}
@@ -0,0 +1,198 @@
+package mds
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Limits used by EstimateChunking
+const (
+	// MinParallelChunkSize keeps small objects from being split into tiny requests
+	MinParallelChunkSize = 4 << 20
+	// MaxParallelConcurrency caps requests of a single GetParallel
+	MaxParallelConcurrency = 16
+)
+
+// ErrChunkTimeout means that a chunk of GetParallel exceeded ParallelOptions.ChunkTimeout.
+// Such chunks are retried.
+var ErrChunkTimeout = errors.New("chunk timed out")
+
+// ParallelOptions tune GetParallel
+type ParallelOptions struct {
+	// ChunkSize and Concurrency are estimated with EstimateChunking if they are not set.
+	ChunkSize   int64
+	Concurrency int
+	// ChunkTimeout limits reading a single chunk, so a stuck one is retried
+	// without failing the whole download. There is no limit by default.
+	ChunkTimeout time.Duration
+	// Retry is applied to every chunk including reading its body,
+	// DefaultChunkAttempts are made if MaxAttempts is not set.
+	Retry RetryPolicy
+}
+
+// EstimateChunking returns a chunk size and a number of concurrent requests
+// to download size bytes with GetParallel using up to concurrency requests.
+// Chunks are at least MinParallelChunkSize, so small objects are read by a single request,
+// and concurrency is capped by MaxParallelConcurrency.
+func EstimateChunking(size int64, concurrency int) (chunkSize int64, parallelism int) {
+	if concurrency <= 0 || concurrency > MaxParallelConcurrency {
+		concurrency = MaxParallelConcurrency
+	}
+	if size <= 0 {
+		return MinParallelChunkSize, 1
+	}
+
+	chunkSize = (size + int64(concurrency) - 1) / int64(concurrency)
+	if chunkSize < MinParallelChunkSize {
+		chunkSize = MinParallelChunkSize
+	}
+	return chunkSize, int((size + chunkSize - 1) / chunkSize)
+}
+
+// GetParallel downloads key into w by concurrent Range requests, which is much faster
+// than a single stream on links with high latency. Chunks are written at their offsets,
+// so w is usually a file, see GetParallelFile. A failed chunk is retried on its own
+// according to ParallelOptions.Retry. If the object is overwritten during the download,
+// it fails with ObjectChangedError.
+// An object without a known size or Range support is read by a single request.
+// It returns a size of the object.
+func (m *Client) GetParallel(ctx context.Context, namespace, key string, w io.WriterAt, opts ParallelOptions) (int64, error) {
+	info, err := m.Stat(ctx, namespace, key)
+	if err != nil {
+		return 0, err
+	}
+	if info.Size < 0 || !info.RangesSupported {
+		return m.DownloadTo(ctx, namespace, key, &offsetWriter{w: w})
+	}
+
+	chunkSize, concurrency := EstimateChunking(info.Size, opts.Concurrency)
+	if opts.ChunkSize > 0 {
+		chunkSize = opts.ChunkSize
+	}
+	if opts.Concurrency > 0 {
+		concurrency = opts.Concurrency
+	}
+	if opts.Retry.MaxAttempts <= 0 {
+		opts.Retry.MaxAttempts = DefaultChunkAttempts
+	}
+
+	chunks := int((info.Size + chunkSize - 1) / chunkSize)
+	errs := make([]error, chunks)
+	m.runBatch(ctx, chunks, concurrency, func(n int, err error) {
+		if err != nil {
+			errs[n] = err
+			return
+		}
+
+		offset := int64(n) * chunkSize
+		length := chunkSize
+		if info.Size-offset < length {
+			length = info.Size - offset
+		}
+		// opts.Retry replaces Config.Retry, so attempts don't multiply
+		errs[n] = m.retryWith(ctx, opts.Retry, func() error {
+			return m.getChunk(ctx, namespace, key, info, offset, length, w, opts.ChunkTimeout)
+		})
+	})
+
+	for n, err := range errs {
+		if err != nil {
+			return 0, fmt.Errorf("chunk %d: %w", n, err)
+		}
+	}
+	return info.Size, nil
+}
+
+// getChunk reads length bytes at offset of key into w by a single request.
+// The chunk must belong to the version of the object described by info.
+func (m *Client) getChunk(ctx context.Context, namespace, key string, info *ObjectInfo, offset, length int64, w io.WriterAt, timeout time.Duration) error {
+	cctx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		cctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	timedOut := func(err error) error {
+		if cctx.Err() != nil && ctx.Err() == nil {
+			return fmt.Errorf("%w after %v: %v", ErrChunkTimeout, timeout, err)
+		}
+		return err
+	}
+
+	header := make(http.Header)
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	if info.ETag != "" {
+		// a changed object is replied as a whole
+		header.Set("If-Range", info.ETag)
+	}
+	resp, err := m.getOnce(cctx, namespace, key, header)
+	var mErr MethodError
+	if errors.As(err, &mErr) && mErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// the object got shorter
+		return ObjectChangedError{Key: key, Size: info.Size, Observed: -1}
+	}
+	if err != nil {
+		return timedOut(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return ObjectChangedError{Key: key, Size: info.Size, Observed: resp.ContentLength}
+	}
+	first, last, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+	if err != nil {
+		return err
+	}
+	if size != info.Size {
+		return ObjectChangedError{Key: key, Size: info.Size, Observed: size}
+	}
+	if first != offset || last-first+1 != length {
+		return fmt.Errorf("proxy returned %d bytes at %d instead of %d at %d", last-first+1, first, length, offset)
+	}
+
+	n, err := m.copy(&offsetWriter{w: w, offset: offset}, io.LimitReader(resp.Body, length))
+	if err != nil {
+		return timedOut(err)
+	}
+	if n != length {
+		return SizeMismatchError{Declared: length, Observed: n}
+	}
+	return nil
+}
+
+// GetParallelFile downloads key with GetParallel into a file at path,
+// which is created or truncated. The file is removed if the download fails.
+func (m *Client) GetParallelFile(ctx context.Context, namespace, key, path string, opts ParallelOptions) (int64, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := m.GetParallel(ctx, namespace, key, file, opts)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return 0, err
+	}
+	return n, nil
+}
+
+// offsetWriter writes sequentially to w starting at offset
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.w.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
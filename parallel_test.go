@@ -0,0 +1,203 @@
+package mds
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// bufferAt is an in-memory io.WriterAt
+type bufferAt struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *bufferAt) WriteAt(p []byte, off int64) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if end := int(off) + len(p); end > len(b.buf) {
+		b.buf = append(b.buf, make([]byte, end-len(b.buf))...)
+	}
+	return copy(b.buf[off:], p), nil
+}
+
+func TestEstimateChunking(t *testing.T) {
+	for _, tc := range []struct {
+		size        int64
+		concurrency int
+		chunkSize   int64
+		parallelism int
+	}{
+		{0, 4, MinParallelChunkSize, 1},
+		{1 << 20, 4, MinParallelChunkSize, 1},
+		{10 << 20, 4, MinParallelChunkSize, 3},
+		{64 << 20, 4, 16 << 20, 4},
+		{1 << 30, 0, 64 << 20, MaxParallelConcurrency},
+		{1 << 30, 100, 64 << 20, MaxParallelConcurrency},
+	} {
+		chunkSize, parallelism := EstimateChunking(tc.size, tc.concurrency)
+		assert.Equal(t, tc.chunkSize, chunkSize, "size %d concurrency %d", tc.size, tc.concurrency)
+		assert.Equal(t, tc.parallelism, parallelism, "size %d concurrency %d", tc.size, tc.concurrency)
+	}
+}
+
+func TestGetParallel(t *testing.T) {
+	blob := make([]byte, 1000)
+	for i := range blob {
+		blob[i] = byte(i)
+	}
+	var ranged, stuck int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/get-ns/1/key" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Range") != "" {
+			atomic.AddInt32(&ranged, 1)
+		}
+		// the first request of the chunk at 500 gets stuck
+		if r.Header.Get("Range") == "bytes=500-599" && atomic.CompareAndSwapInt32(&stuck, 0, 1) {
+			<-r.Context().Done()
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	cli.setClock(newFakeClock())
+	ctx := context.Background()
+
+	var w bufferAt
+	n, err := cli.GetParallel(ctx, "ns", "1/key", &w, ParallelOptions{
+		ChunkSize:    100,
+		Concurrency:  4,
+		ChunkTimeout: 100 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(blob)), n)
+	assert.Equal(t, blob, w.buf)
+	assert.Equal(t, int32(11), atomic.LoadInt32(&ranged))
+
+	dir, err := ioutil.TempDir("", "mds-parallel")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "file")
+	n, err = cli.GetParallelFile(ctx, "ns", "1/key", path, ParallelOptions{ChunkSize: 300})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(blob)), n)
+	body, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, blob, body)
+
+	path = filepath.Join(dir, "missing")
+	_, err = cli.GetParallelFile(ctx, "ns", "1/missing", path, ParallelOptions{})
+	assert.True(t, errors.Is(err, ErrKeyNotFound))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestGetParallelFailure(t *testing.T) {
+	var failed int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") == "bytes=4-7" {
+			atomic.AddInt32(&failed, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader([]byte(rangeBlob)))
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	cli.setClock(newFakeClock())
+	cli.Retry = RetryPolicy{MaxAttempts: 5}
+
+	dir, err := ioutil.TempDir("", "mds-parallel")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "file")
+	_, err = cli.GetParallelFile(context.Background(), "ns", "1/key", path, ParallelOptions{ChunkSize: 4})
+	var mErr MethodError
+	if assert.True(t, errors.As(err, &mErr), "%v", err) {
+		assert.Equal(t, http.StatusInternalServerError, mErr.StatusCode)
+	}
+	// ParallelOptions.Retry replaces Config.Retry
+	assert.Equal(t, int32(DefaultChunkAttempts), atomic.LoadInt32(&failed))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestGetParallelObjectChanged(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		etag      string
+		overwrite string
+	}{
+		{"etag", `"v1"`, strings.Repeat("b", 1000)},
+		{"size", "", strings.Repeat("b", 1500)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, etag := strings.Repeat("a", 1000), tc.etag
+				// the object is overwritten after the first chunk
+				if r.Header.Get("Range") != "" && atomic.AddInt32(&requests, 1) > 1 {
+					body = tc.overwrite
+					if etag != "" {
+						etag = `"v2"`
+					}
+				}
+				if etag != "" {
+					w.Header().Set("ETag", etag)
+				}
+				http.ServeContent(w, r, "", time.Time{}, strings.NewReader(body))
+			}))
+			defer srv.Close()
+
+			cli := newTestClient(t, srv)
+			cli.setClock(newFakeClock())
+
+			var w bufferAt
+			_, err := cli.GetParallel(context.Background(), "ns", "1/key", &w, ParallelOptions{ChunkSize: 100, Concurrency: 1})
+			var cErr ObjectChangedError
+			if assert.True(t, errors.As(err, &cErr), "%v", err) {
+				assert.Equal(t, int64(1000), cErr.Size)
+			}
+			assert.True(t, errors.Is(err, ErrObjectChanged))
+		})
+	}
+}
+
+func TestGetParallelWithoutRanges(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Range"))
+		w.Write([]byte(rangeBlob))
+	}))
+	defer srv.Close()
+
+	var w bufferAt
+	n, err := newTestClient(t, srv).GetParallel(context.Background(), "ns", "1/key", &w, ParallelOptions{ChunkSize: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(rangeBlob)), n)
+	assert.Equal(t, rangeBlob, string(w.buf))
+}
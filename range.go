@@ -0,0 +1,265 @@
+package mds
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// GetRange reads length bytes of key starting at offset.
+// Unlike an inclusive range of Get, there is no need to compute the last byte.
+// A zero length or an offset at or after the end of the object
+// result in an empty body, like reading past the end of a file.
+// User is responsible for closing returned ReadCloser.
+func (m *Client) GetRange(ctx context.Context, namespace, key string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("invalid range: offset %d, length %d", offset, length)
+	}
+	if length == 0 {
+		return emptyBody(), nil
+	}
+
+	resp, err := m.get(ctx, namespace, key, uint64(offset), uint64(offset+length-1))
+	var mErr MethodError
+	if errors.As(err, &mErr) && mErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return emptyBody(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// RangeReader is a body of a ranged read, which knows its place within the object
+type RangeReader struct {
+	io.ReadCloser
+
+	offset int64
+	length int64
+	size   int64
+}
+
+// Offset returns a position of the first byte of the range within the object.
+func (r *RangeReader) Offset() int64 {
+	return r.offset
+}
+
+// Len returns a length of the range. It may be shorter than requested
+// if the range goes past the end of the object.
+func (r *RangeReader) Len() int64 {
+	return r.length
+}
+
+// Size returns a size of the whole object or -1 if the proxy didn't report it.
+func (r *RangeReader) Size() int64 {
+	return r.size
+}
+
+// GetRangeReader is like GetRange, but the returned reader reports
+// the actual range taken from Content-Range header.
+// User is responsible for closing returned RangeReader.
+func (m *Client) GetRangeReader(ctx context.Context, namespace, key string, offset, length int64) (*RangeReader, error) {
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("invalid range: offset %d, length %d", offset, length)
+	}
+	if length == 0 {
+		return &RangeReader{ReadCloser: emptyBody(), offset: offset, size: -1}, nil
+	}
+
+	resp, err := m.get(ctx, namespace, key, uint64(offset), uint64(offset+length-1))
+	var mErr MethodError
+	if errors.As(err, &mErr) && mErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return &RangeReader{ReadCloser: emptyBody(), offset: offset, size: -1}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusPartialContent {
+		// the whole object is returned
+		return &RangeReader{
+			ReadCloser: resp.Body,
+			length:     resp.ContentLength,
+			size:       resp.ContentLength,
+		}, nil
+	}
+
+	first, last, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return &RangeReader{
+		ReadCloser: resp.Body,
+		offset:     first,
+		length:     last - first + 1,
+		size:       size,
+	}, nil
+}
+
+// parseContentRange parses "bytes first-last/size", size is -1 if it's "*"
+func parseContentRange(header string) (first, last, size int64, err error) {
+	malformed := fmt.Errorf("malformed Content-Range %q", header)
+
+	if !strings.HasPrefix(header, "bytes ") {
+		return 0, 0, 0, malformed
+	}
+	i := strings.IndexByte(header, '/')
+	if i < 0 {
+		return 0, 0, 0, malformed
+	}
+	rng, total := header[len("bytes "):i], header[i+1:]
+
+	size = -1
+	if total != "*" {
+		if size, err = strconv.ParseInt(total, 10, 64); err != nil {
+			return 0, 0, 0, malformed
+		}
+	}
+
+	j := strings.IndexByte(rng, '-')
+	if j < 0 {
+		return 0, 0, 0, malformed
+	}
+	first, err = strconv.ParseInt(rng[:j], 10, 64)
+	if err != nil {
+		return 0, 0, 0, malformed
+	}
+	last, err = strconv.ParseInt(rng[j+1:], 10, 64)
+	if err != nil || first < 0 || last < first || (size >= 0 && last >= size) {
+		return 0, 0, 0, malformed
+	}
+	return first, last, size, nil
+}
+
+// GetRangeInclusive reads bytes of key from start to end including both,
+// like HTTP Range header does: [start, end].
+// GetRangeInclusive(ctx, ns, key, 2, 4) returns 3 bytes.
+// User is responsible for closing returned ReadCloser.
+func (m *Client) GetRangeInclusive(ctx context.Context, namespace, key string, start, end int64) (io.ReadCloser, error) {
+	if end < start {
+		return nil, fmt.Errorf("invalid inclusive range [%d, %d]", start, end)
+	}
+	return m.GetRange(ctx, namespace, key, start, end-start+1)
+}
+
+// GetRangeHalfOpen reads bytes of key from start up to, but not including, end,
+// like Go slices do: [start, end).
+// GetRangeHalfOpen(ctx, ns, key, 2, 4) returns 2 bytes, the same as data[2:4].
+// User is responsible for closing returned ReadCloser.
+func (m *Client) GetRangeHalfOpen(ctx context.Context, namespace, key string, start, end int64) (io.ReadCloser, error) {
+	if end < start {
+		return nil, fmt.Errorf("invalid half-open range [%d, %d)", start, end)
+	}
+	return m.GetRange(ctx, namespace, key, start, end-start)
+}
+
+// GetRangeIf is like GetRange, but the range is read only if the object
+// still matches validator, which is either an ETag or an HTTP date (see If-Range header).
+// Otherwise the whole object is returned and partial is false,
+// so a caller resuming a download should start over. Metadata of the returned Object
+// describe the current version of the object, Size is a length of Body.
+// User is responsible for closing Body.
+func (m *Client) GetRangeIf(ctx context.Context, namespace, key string, offset, length int64, validator string) (obj *Object, partial bool, err error) {
+	if offset < 0 || length <= 0 {
+		return nil, false, fmt.Errorf("invalid range: offset %d, length %d", offset, length)
+	}
+
+	header := make(http.Header)
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	header.Set("If-Range", validator)
+	resp, err := m.getWithHeader(ctx, namespace, key, header)
+	var mErr MethodError
+	if errors.As(err, &mErr) && mErr.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		// the range is validated, it's just past the end
+		return &Object{Body: emptyBody()}, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	obj = &Object{
+		ObjectInfo: newObjectInfo(resp),
+		Body:       resp.Body,
+	}
+	return obj, resp.StatusCode == http.StatusPartialContent, nil
+}
+
+// ChunkIterator reads an object in successive chunks of a fixed size,
+// each with its own ranged request, so the object is never held in memory as a whole.
+type ChunkIterator struct {
+	client    *Client
+	namespace string
+	key       string
+	chunkSize int64
+
+	offset int64
+	done   bool
+}
+
+// NewChunkIterator creates an iterator over key reading chunkSize bytes at a time.
+func (m *Client) NewChunkIterator(namespace, key string, chunkSize int64) *ChunkIterator {
+	return &ChunkIterator{
+		client:    m,
+		namespace: namespace,
+		key:       key,
+		chunkSize: chunkSize,
+	}
+}
+
+// Next returns the next chunk. The last one may be shorter than the chunk size.
+// io.EOF is returned once the object is over. A failed chunk could be retried
+// by calling Next again, the iterator advances only on success.
+// A reply which isn't the requested range, e.g. the whole object, is an error.
+func (it *ChunkIterator) Next(ctx context.Context) ([]byte, error) {
+	if it.chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %d", it.chunkSize)
+	}
+	if it.done {
+		return nil, io.EOF
+	}
+
+	rd, err := it.client.GetRangeReader(ctx, it.namespace, it.key, it.offset, it.chunkSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+
+	// a proxy ignoring Range replies with the whole object
+	if rd.Offset() != it.offset || rd.Len() < 0 || rd.Len() > it.chunkSize {
+		return nil, fmt.Errorf("proxy returned %d bytes at %d instead of up to %d at %d", rd.Len(), rd.Offset(), it.chunkSize, it.offset)
+	}
+
+	chunk, err := ioutil.ReadAll(io.LimitReader(rd, rd.Len()))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(chunk)) != rd.Len() {
+		return nil, SizeMismatchError{Declared: rd.Len(), Observed: int64(len(chunk))}
+	}
+
+	it.offset += int64(len(chunk))
+	if int64(len(chunk)) < it.chunkSize {
+		it.done = true
+	}
+	if len(chunk) == 0 {
+		return nil, io.EOF
+	}
+	return chunk, nil
+}
+
+// Offset returns a position of the next chunk within the object.
+func (it *ChunkIterator) Offset() int64 {
+	return it.offset
+}
+
+func emptyBody() io.ReadCloser {
+	return ioutil.NopCloser(bytes.NewReader(nil))
+}
@@ -0,0 +1,259 @@
+package mds
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+const rangeBlob = "TESTBLOB"
+
+func newRangeServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(rangeBlob))
+	}))
+}
+
+func TestGetRange(t *testing.T) {
+	srv := newRangeServer()
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		offset, length int64
+		expected       string
+	}{
+		{0, 8, "TESTBLOB"},
+		{2, 3, "STB"},
+		{4, 100, "BLOB"},
+		{7, 1, "B"},
+		{3, 0, ""},
+		{8, 1, ""},
+		{100, 5, ""},
+	} {
+		rd, err := cli.GetRange(ctx, "ns", "1/key", tc.offset, tc.length)
+		if !assert.NoError(t, err, "offset %d length %d", tc.offset, tc.length) {
+			continue
+		}
+		body, err := ioutil.ReadAll(rd)
+		rd.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, string(body), "offset %d length %d", tc.offset, tc.length)
+	}
+
+	_, err := cli.GetRange(ctx, "ns", "1/key", -1, 2)
+	assert.Error(t, err)
+	_, err = cli.GetRange(ctx, "ns", "1/key", 0, -2)
+	assert.Error(t, err)
+}
+
+func TestGetRangeReader(t *testing.T) {
+	srv := newRangeServer()
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		offset, length int64
+		expected       string
+		size           int64
+	}{
+		{2, 3, "STB", 8},
+		{4, 100, "BLOB", 8},
+		{3, 0, "", -1},
+		{100, 5, "", -1},
+	} {
+		rd, err := cli.GetRangeReader(ctx, "ns", "1/key", tc.offset, tc.length)
+		if !assert.NoError(t, err, "offset %d length %d", tc.offset, tc.length) {
+			continue
+		}
+		body, err := ioutil.ReadAll(rd)
+		rd.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expected, string(body))
+		assert.Equal(t, tc.offset, rd.Offset())
+		assert.Equal(t, int64(len(tc.expected)), rd.Len())
+		assert.Equal(t, tc.size, rd.Size())
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	first, last, size, err := parseContentRange("bytes 2-4/8")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int64{2, 4, 8}, []int64{first, last, size})
+	}
+	first, last, size, err = parseContentRange("bytes 0-0/*")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int64{0, 0, -1}, []int64{first, last, size})
+	}
+
+	for _, malformed := range []string{"", "bytes */8", "bytes 4-2/8", "bytes 2-8/8", "bytes 2-4", "items 2-4/8", "bytes -2-4/8"} {
+		_, _, _, err = parseContentRange(malformed)
+		assert.Error(t, err, malformed)
+	}
+}
+
+func TestGetRangeInclusiveAndHalfOpen(t *testing.T) {
+	srv := newRangeServer()
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+	blob := []byte(rangeBlob)
+
+	read := func(rd io.ReadCloser, err error) string {
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer rd.Close()
+		body, err := ioutil.ReadAll(rd)
+		assert.NoError(t, err)
+		return string(body)
+	}
+
+	for _, r := range [][2]int64{{0, 7}, {2, 4}, {3, 3}, {6, 7}} {
+		start, end := r[0], r[1]
+		assert.Equal(t, string(blob[start:end+1]), read(cli.GetRangeInclusive(ctx, "ns", "1/key", start, end)), "[%d, %d]", start, end)
+	}
+
+	for _, r := range [][2]int64{{0, 8}, {2, 4}, {3, 3}, {6, 7}} {
+		start, end := r[0], r[1]
+		assert.Equal(t, string(blob[start:end]), read(cli.GetRangeHalfOpen(ctx, "ns", "1/key", start, end)), "[%d, %d)", start, end)
+	}
+
+	_, err := cli.GetRangeInclusive(ctx, "ns", "1/key", 4, 2)
+	assert.Error(t, err)
+	_, err = cli.GetRangeHalfOpen(ctx, "ns", "1/key", 4, 2)
+	assert.Error(t, err)
+}
+
+func TestGetRangeIf(t *testing.T) {
+	modTime := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	etag := `"v1"`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "", modTime, strings.NewReader(rangeBlob))
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	read := func(validator string) (string, bool, *Object) {
+		obj, partial, err := cli.GetRangeIf(ctx, "ns", "1/key", 2, 3, validator)
+		if !assert.NoError(t, err, validator) {
+			t.FailNow()
+		}
+		defer obj.Body.Close()
+		body, err := ioutil.ReadAll(obj.Body)
+		assert.NoError(t, err)
+		return string(body), partial, obj
+	}
+
+	body, partial, obj := read(`"v1"`)
+	assert.True(t, partial)
+	assert.Equal(t, "STB", body)
+	assert.Equal(t, int64(3), obj.Size)
+
+	body, partial, _ = read(modTime.Format(http.TimeFormat))
+	assert.True(t, partial)
+	assert.Equal(t, "STB", body)
+
+	etag = `"v2"`
+	body, partial, obj = read(`"v1"`)
+	assert.False(t, partial)
+	assert.Equal(t, rangeBlob, body)
+	assert.Equal(t, `"v2"`, obj.ETag)
+
+	obj, partial, err := cli.GetRangeIf(ctx, "ns", "1/key", 100, 3, `"v2"`)
+	if assert.NoError(t, err) {
+		assert.True(t, partial)
+		obj.Body.Close()
+	}
+
+	_, _, err = cli.GetRangeIf(ctx, "ns", "1/key", 0, 0, `"v2"`)
+	assert.Error(t, err)
+}
+
+func TestGetRangeEncoded(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(rangeBlob))
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	_, err := cli.GetRange(ctx, "ns", "1/key", 2, 3)
+	assert.True(t, errors.Is(err, ErrEncodedRange))
+	_, err = cli.Get(ctx, "ns", "1/key", 2)
+	assert.True(t, errors.Is(err, ErrEncodedRange))
+
+	// the whole object is returned as is
+	rd, err := cli.Get(ctx, "ns", "1/key")
+	if assert.NoError(t, err) {
+		rd.Close()
+	}
+}
+
+func TestChunkIterator(t *testing.T) {
+	srv := newRangeServer()
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		chunkSize int64
+		expected  []string
+	}{
+		{3, []string{"TES", "TBL", "OB"}},
+		{4, []string{"TEST", "BLOB"}},
+		{100, []string{"TESTBLOB"}},
+	} {
+		it := cli.NewChunkIterator("ns", "1/key", tc.chunkSize)
+		var chunks []string
+		for {
+			chunk, err := it.Next(ctx)
+			if err == io.EOF {
+				break
+			}
+			if !assert.NoError(t, err) {
+				break
+			}
+			chunks = append(chunks, string(chunk))
+		}
+		assert.Equal(t, tc.expected, chunks, "chunk size %d", tc.chunkSize)
+		assert.Equal(t, int64(len(rangeBlob)), it.Offset())
+
+		_, err := it.Next(ctx)
+		assert.Equal(t, io.EOF, err)
+	}
+
+	_, err := cli.NewChunkIterator("ns", "1/key", 0).Next(ctx)
+	assert.Error(t, err)
+}
+
+func TestChunkIteratorWithoutRanges(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(rangeBlob))
+	}))
+	defer srv.Close()
+
+	it := newTestClient(t, srv).NewChunkIterator("ns", "1/key", 3)
+	_, err := it.Next(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, int64(0), it.Offset())
+}
@@ -0,0 +1,171 @@
+package mds
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/net/context"
+)
+
+// ErrRangesNotSupported means that an object can't be read at random offsets,
+// because its size is unknown or the proxy doesn't accept ranges for it.
+var ErrRangesNotSupported = errors.New("ranges are not supported")
+
+// ObjectReader gives random access to an object by Range requests.
+// It implements io.ReadSeeker and io.ReaderAt, e.g. for archive/zip.
+// Sequential reads share a single request, which is restarted after Seek.
+// ReadAt is safe for concurrent use, Read and Seek are not.
+type ObjectReader struct {
+	m         *Client
+	ctx       context.Context
+	namespace string
+	key       string
+	info      *ObjectInfo
+	size      int64
+
+	offset int64
+	// body is a ranged read from bodyOffset till the end of the object
+	body       io.ReadCloser
+	bodyOffset int64
+}
+
+// OpenReader returns ObjectReader of key. The object must have a known size
+// and the proxy must support ranges for it, otherwise ErrRangesNotSupported is returned.
+// ctx is used by all requests of the reader. User is responsible for closing it.
+func (m *Client) OpenReader(ctx context.Context, namespace, key string) (*ObjectReader, error) {
+	info, err := m.Stat(ctx, namespace, key)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size < 0 || !info.RangesSupported {
+		return nil, fmt.Errorf("random access to %s: %w: size %d, ranges supported %v", key, ErrRangesNotSupported, info.Size, info.RangesSupported)
+	}
+
+	return &ObjectReader{
+		m:         m,
+		ctx:       ctx,
+		namespace: namespace,
+		key:       key,
+		info:      info,
+		size:      info.Size,
+	}, nil
+}
+
+// Size returns a size of the object
+func (r *ObjectReader) Size() int64 {
+	return r.size
+}
+
+// Info returns ObjectInfo of the object fetched by OpenReader
+func (r *ObjectReader) Info() *ObjectInfo {
+	return r.info
+}
+
+// Read implements io.Reader
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if r.body == nil || r.bodyOffset != r.offset {
+		r.closeBody()
+		body, err := r.getRange(r.offset, r.size-r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.body, r.bodyOffset = body, r.offset
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	r.bodyOffset += int64(n)
+	if err == io.EOF {
+		r.closeBody()
+		if r.offset < r.size {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// ReadAt implements io.ReaderAt with a request per call
+func (r *ObjectReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	length := int64(len(p))
+	if r.size-off < length {
+		length = r.size - off
+	}
+	body, err := r.getRange(off, length)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	n, err := io.ReadFull(body, p[:length])
+	if err != nil {
+		return n, err
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// getRange reads length bytes at offset, which must be within the object.
+// A reply with other bytes, e.g. the whole object from a proxy ignoring Range, is an error.
+func (r *ObjectReader) getRange(offset, length int64) (io.ReadCloser, error) {
+	rd, err := r.m.GetRangeReader(r.ctx, r.namespace, r.key, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	if rd.Offset() != offset || rd.Len() != length {
+		rd.Close()
+		return nil, fmt.Errorf("proxy returned %d bytes at %d instead of %d at %d", rd.Len(), rd.Offset(), length, offset)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(rd, length), rd}, nil
+}
+
+// Close releases a request of sequential reads
+func (r *ObjectReader) Close() error {
+	return r.closeBody()
+}
+
+func (r *ObjectReader) closeBody() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
@@ -0,0 +1,195 @@
+package mds
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestObjectReader(t *testing.T) {
+	var gets int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			atomic.AddInt32(&gets, 1)
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader([]byte(rangeBlob)))
+	}))
+	defer srv.Close()
+
+	rd, err := newTestClient(t, srv).OpenReader(context.Background(), "ns", "1/key")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer rd.Close()
+	assert.Equal(t, int64(len(rangeBlob)), rd.Size())
+	assert.True(t, rd.Info().RangesSupported)
+
+	// sequential reads share a request
+	buf := make([]byte, 3)
+	for _, expected := range []string{"TES", "TBL", "OB"} {
+		n, err := io.ReadFull(rd, buf[:len(expected)])
+		assert.NoError(t, err)
+		assert.Equal(t, expected, string(buf[:n]))
+	}
+	_, err = rd.Read(buf)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&gets))
+
+	pos, err := rd.Seek(-4, io.SeekEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), pos)
+	body, err := ioutil.ReadAll(rd)
+	assert.NoError(t, err)
+	assert.Equal(t, "BLOB", string(body))
+
+	pos, err = rd.Seek(-6, io.SeekCurrent)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), pos)
+	n, err := rd.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "STB", string(buf[:n]))
+
+	_, err = rd.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+
+	n, err = rd.ReadAt(buf, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "EST", string(buf[:n]))
+	n, err = rd.ReadAt(buf, 6)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, "OB", string(buf[:n]))
+	_, err = rd.ReadAt(buf, 8)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestObjectReaderZip(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		fw, err := zw.Create(name)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		io.WriteString(fw, "content of "+name)
+	}
+	if !assert.NoError(t, zw.Close()) {
+		t.FailNow()
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(archive.Bytes()))
+	}))
+	defer srv.Close()
+
+	rd, err := newTestClient(t, srv).OpenReader(context.Background(), "ns", "1/archive.zip")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer rd.Close()
+
+	zr, err := zip.NewReader(rd, rd.Size())
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if assert.Len(t, zr.File, 2) {
+		fr, err := zr.File[1].Open()
+		if assert.NoError(t, err) {
+			body, err := ioutil.ReadAll(fr)
+			assert.NoError(t, err)
+			assert.Equal(t, "content of b.txt", string(body))
+			fr.Close()
+		}
+	}
+}
+
+func TestObjectReaderWithoutRanges(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(rangeBlob))
+	}))
+	defer srv.Close()
+
+	_, err := newTestClient(t, srv).OpenReader(context.Background(), "ns", "1/key")
+	assert.True(t, errors.Is(err, ErrRangesNotSupported), "%v", err)
+}
+
+func TestObjectReaderIgnoredRange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Accept-Ranges is announced, but Range is ignored
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Write([]byte(rangeBlob))
+	}))
+	defer srv.Close()
+
+	rd, err := newTestClient(t, srv).OpenReader(context.Background(), "ns", "1/key")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer rd.Close()
+
+	buf := make([]byte, 4)
+	_, err = rd.ReadAt(buf, 4)
+	assert.Error(t, err)
+	_, err = rd.Seek(4, io.SeekStart)
+	assert.NoError(t, err)
+	_, err = rd.Read(buf)
+	assert.Error(t, err)
+}
+
+// benchmarkObjectReader reads a 1MiB object by 4KiB reads at offsets returned by next
+// and reports GET requests per read
+func benchmarkObjectReader(b *testing.B, next func(i int) int64) {
+	const size, readSize = 1 << 20, 4 << 10
+	blob := bytes.Repeat([]byte("TESTBLOB"), size/8)
+	var gets int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			atomic.AddInt64(&gets, 1)
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+	}))
+	defer srv.Close()
+
+	rd, err := newTestClient(b, srv).OpenReader(context.Background(), "ns", "1/key")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer rd.Close()
+
+	buf := make([]byte, readSize)
+	b.SetBytes(readSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := rd.Seek(next(i)%(size-readSize), io.SeekStart); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(atomic.LoadInt64(&gets))/float64(b.N), "requests/op")
+}
+
+func BenchmarkObjectReaderSequential(b *testing.B) {
+	benchmarkObjectReader(b, func(i int) int64 {
+		return int64(i) * 4 << 10
+	})
+}
+
+func BenchmarkObjectReaderRandom(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	benchmarkObjectReader(b, func(i int) int64 {
+		return rnd.Int63()
+	})
+}
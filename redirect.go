@@ -0,0 +1,43 @@
+package mds
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const defaultMaxRedirects = 10
+
+// withRedirectPolicy returns a copy of client which limits redirects
+// and strips Authorization header on redirects to other hosts.
+// CheckRedirect of client, if any, is still consulted.
+func withRedirectPolicy(client *http.Client, maxRedirects int, policy func(*http.Request, []*http.Request) error) *http.Client {
+	if maxRedirects == 0 {
+		maxRedirects = defaultMaxRedirects
+	}
+	next := client.CheckRedirect
+
+	rclient := *client
+	rclient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if maxRedirects < 0 {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+
+		if req.URL.Host != via[0].URL.Host {
+			req.Header.Del("Authorization")
+		}
+
+		if policy != nil {
+			if err := policy(req, via); err != nil {
+				return err
+			}
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		return nil
+	}
+	return &rclient
+}
@@ -0,0 +1,96 @@
+package mds
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestRedirectStripsAuthorizationCrossHost(t *testing.T) {
+	var auth []string
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+	}))
+	defer storage.Close()
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		if r.URL.Path == "/get-ns/1/key" {
+			http.Redirect(w, r, "/get-ns/1/moved", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, storage.URL+"/data", http.StatusFound)
+	}))
+	defer proxy.Close()
+
+	cli := newTestClient(t, proxy)
+	_, err := cli.GetFile(context.Background(), "ns", "1/key")
+	assert.NoError(t, err)
+
+	// same host redirect keeps credentials, the other host doesn't get them
+	assert.Equal(t, []string{cli.AuthHeader, cli.AuthHeader, ""}, auth)
+}
+
+func TestMaxRedirects(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Redirect(w, r, r.URL.Path, http.StatusFound)
+	}))
+	defer srv.Close()
+
+	port := serverPort(t, srv)
+	cli, err := NewClient(Config{
+		Host:         "127.0.0.1",
+		UploadPort:   port,
+		ReadPort:     port,
+		MaxRedirects: 3,
+	}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	_, err = cli.Get(context.Background(), "ns", "1/key")
+	assert.Error(t, err)
+	assert.Equal(t, 4, requests)
+
+	requests = 0
+	cli.client = withRedirectPolicy(http.DefaultClient, -1, nil)
+	_, err = cli.Get(context.Background(), "ns", "1/key")
+	var mErr MethodError
+	if assert.True(t, errors.As(err, &mErr)) {
+		assert.Equal(t, http.StatusFound, mErr.StatusCode)
+	}
+	assert.Equal(t, 1, requests)
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://example.com/data", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	errForbiddenHost := errors.New("forbidden host")
+	port := serverPort(t, srv)
+	cli, err := NewClient(Config{
+		Host:       "127.0.0.1",
+		UploadPort: port,
+		ReadPort:   port,
+		RedirectPolicy: func(req *http.Request, via []*http.Request) error {
+			if req.URL.Hostname() != "127.0.0.1" {
+				return errForbiddenHost
+			}
+			return nil
+		},
+	}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	_, err = cli.Get(context.Background(), "ns", "1/key")
+	assert.True(t, errors.Is(err, errForbiddenHost), "%v", err)
+}
@@ -0,0 +1,97 @@
+package mds
+
+import (
+	"errors"
+	"math/rand"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Defaults used by RetryPolicy
+const (
+	DefaultRetryBaseDelay = 100 * time.Millisecond
+	DefaultRetryMaxDelay  = 5 * time.Second
+)
+
+// DefaultRetryableStatuses are retried unless RetryPolicy.RetryableStatuses is set
+var DefaultRetryableStatuses = []int{500, 502, 503, 504}
+
+// RetryPolicy describes retries of idempotent operations.
+// Replies with retryable statuses, transport failures and broken connections are retried,
+// waiting BaseDelay*2^n between attempts, capped by MaxDelay.
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt. Zero or one disables retries.
+	MaxAttempts int
+	// BaseDelay and MaxDelay are replaced with defaults if they are not set.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter is a fraction of a delay, which is randomly subtracted from it,
+	// so clients failed at once don't retry in lockstep. It's between 0 and 1.
+	Jitter float64
+	// RetryableStatuses overrides DefaultRetryableStatuses.
+	RetryableStatuses []int
+}
+
+// delay returns a pause before attempt, which is 1 for the first retry
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	base, max := p.BaseDelay, p.MaxDelay
+	if base <= 0 {
+		base = DefaultRetryBaseDelay
+	}
+	if max <= 0 {
+		max = DefaultRetryMaxDelay
+	}
+
+	d := max
+	if shift := uint(attempt - 1); shift < 32 && base<<shift < max {
+		d = base << shift
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(float64(d) * p.Jitter * rand.Float64())
+	}
+	return d
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	var mErr MethodError
+	if errors.As(err, &mErr) {
+		statuses := p.RetryableStatuses
+		if statuses == nil {
+			statuses = DefaultRetryableStatuses
+		}
+		for _, status := range statuses {
+			if status == mErr.StatusCode {
+				return true
+			}
+		}
+		return false
+	}
+
+	if errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	// failures of the transport, e.g. a refused connection
+	var uErr *url.Error
+	return errors.As(err, &uErr) || errors.Is(err, ErrConnectionReset) || errors.Is(err, ErrChunkTimeout)
+}
+
+// retry calls fn until it succeeds, fails with a permanent error
+// or attempts are exhausted according to Config.Retry
+func (m *Client) retry(ctx context.Context, fn func() error) error {
+	return m.retryWith(ctx, m.Retry, fn)
+}
+
+// retryWith is retry according to policy
+func (m *Client) retryWith(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil || !policy.retryable(err) {
+			return err
+		}
+		if serr := m.clock.Sleep(ctx, policy.delay(attempt)); serr != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package mds
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestRetry(t *testing.T) {
+	var requests, failures int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/downloadinfo-ns/"):
+			w.Write([]byte(downloadInfoReply))
+		case r.URL.Path == "/get-ns/1/missing":
+			http.NotFound(w, r)
+		default:
+			w.Write([]byte("TESTBLOB"))
+		}
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	cli.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: 3 * time.Second}
+	clk := newFakeClock()
+	cli.setClock(clk)
+	ctx := context.Background()
+
+	check := func(name string, fn func() error, fail int32, ok bool, attempts int32) {
+		atomic.StoreInt32(&requests, 0)
+		atomic.StoreInt32(&failures, fail)
+		clk.Waits()
+
+		err := fn()
+		if ok {
+			assert.NoError(t, err, name)
+		} else {
+			assert.Error(t, err, name)
+		}
+		assert.Equal(t, attempts, atomic.LoadInt32(&requests), name)
+	}
+
+	check("ping", func() error { return cli.Ping(ctx) }, 2, true, 3)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, clk.Waits())
+
+	check("get", func() error {
+		body, err := cli.GetFile(ctx, "ns", "1/key")
+		assert.Equal(t, "TESTBLOB", string(body))
+		return err
+	}, 1, true, 2)
+	check("delete", func() error { return cli.Delete(ctx, "ns", "1/key") }, 1, true, 2)
+	check("downloadInfo", func() error {
+		_, err := cli.DownloadInfo(ctx, "ns", "1/key")
+		return err
+	}, 1, true, 2)
+
+	check("exhausted", func() error {
+		err := cli.Ping(ctx)
+		assert.True(t, errors.Is(err, ErrUnavailable))
+		return err
+	}, 5, false, 3)
+
+	check("permanent", func() error {
+		_, err := cli.GetFile(ctx, "ns", "1/missing")
+		return err
+	}, 0, false, 1)
+
+	// uploads are never retried
+	check("upload", func() error {
+		_, err := cli.Upload(ctx, "ns", "file", 4, strings.NewReader("TEST"))
+		return err
+	}, 1, false, 1)
+
+	cli.Retry = RetryPolicy{}
+	check("disabled", func() error { return cli.Ping(ctx) }, 1, false, 1)
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := RetryPolicy{}
+	assert.Equal(t, DefaultRetryBaseDelay, policy.delay(1))
+	assert.Equal(t, 2*DefaultRetryBaseDelay, policy.delay(2))
+	assert.Equal(t, DefaultRetryMaxDelay, policy.delay(10))
+	assert.Equal(t, DefaultRetryMaxDelay, policy.delay(100))
+
+	policy = RetryPolicy{BaseDelay: time.Second, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		d := policy.delay(1)
+		assert.True(t, d > time.Second/2 && d <= time.Second, "%v", d)
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	cli.Retry = RetryPolicy{MaxAttempts: 10, BaseDelay: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := cli.Ping(ctx)
+	assert.True(t, errors.Is(err, ErrUnavailable))
+}
@@ -0,0 +1,64 @@
+package mds
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// servedHeaders are copied from a reply of the proxy by ServeObject
+var servedHeaders = []string{
+	"Content-Type",
+	"Content-Range",
+	"ETag",
+	"Last-Modified",
+	"Accept-Ranges",
+	"Cache-Control",
+}
+
+// ServeObject replies to r with an object stored under key.
+// Range and If-Range headers of r are forwarded to the proxy, so the reply is either
+// 200 OK or 206 Partial Content with metadata headers of the object.
+// 404 and 416 statuses of the proxy are passed to w as is, other failures result in 502 Bad Gateway.
+// A returned error is for logging only: a reply is already written to w.
+func (m *Client) ServeObject(w http.ResponseWriter, r *http.Request, namespace, key string) error {
+	header := make(http.Header)
+	if rng := r.Header.Get("Range"); rng != "" {
+		header.Set("Range", rng)
+		if ifRange := r.Header.Get("If-Range"); ifRange != "" {
+			header.Set("If-Range", ifRange)
+		}
+	}
+
+	resp, err := m.getWithHeader(r.Context(), namespace, key, header)
+	if err != nil {
+		status := http.StatusBadGateway
+		var mErr MethodError
+		if errors.As(err, &mErr) {
+			switch mErr.StatusCode {
+			case http.StatusNotFound, http.StatusRequestedRangeNotSatisfiable:
+				status = mErr.StatusCode
+			}
+		}
+		http.Error(w, http.StatusText(status), status)
+		return err
+	}
+	defer resp.Body.Close()
+
+	for _, name := range servedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+	if resp.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	if r.Method == "HEAD" {
+		return nil
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
@@ -0,0 +1,66 @@
+package mds
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeObject(t *testing.T) {
+	modTime := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/get-ns/1/key":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("X-Internal", "secret")
+			http.ServeContent(w, r, "", modTime, strings.NewReader("0123456789"))
+		case "/get-ns/1/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	serve := func(method, key, rng string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/download", nil)
+		if rng != "" {
+			r.Header.Set("Range", rng)
+		}
+		w := httptest.NewRecorder()
+		cli.ServeObject(w, r, "ns", key)
+		return w
+	}
+
+	w := serve("GET", "1/key", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+	assert.Equal(t, "10", w.Header().Get("Content-Length"))
+	assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+	assert.Equal(t, `"v1"`, w.Header().Get("ETag"))
+	assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+	assert.Equal(t, modTime.Format(http.TimeFormat), w.Header().Get("Last-Modified"))
+	assert.Empty(t, w.Header().Get("X-Internal"))
+
+	w = serve("GET", "1/key", "bytes=-3")
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "789", w.Body.String())
+	assert.Equal(t, "bytes 7-9/10", w.Header().Get("Content-Range"))
+
+	w = serve("HEAD", "1/key", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Content-Length"))
+	body, _ := ioutil.ReadAll(w.Body)
+	assert.Empty(t, body)
+
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, serve("GET", "1/key", "bytes=20-").Code)
+	assert.Equal(t, http.StatusNotFound, serve("GET", "1/missing", "").Code)
+	assert.Equal(t, http.StatusBadGateway, serve("GET", "1/broken", "").Code)
+}
@@ -0,0 +1,219 @@
+package mds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// sessionVersion marks serialized upload sessions
+const sessionVersion = 1
+
+// UploadSession is a LargeUpload, which can be resumed after an interruption
+// instead of being restarted. It records chunks accepted by the proxy,
+// so ResumeUpload only sends missing ones. A session survives a restart
+// of a process with Serialize and RestoreUploadSession.
+// It's safe to Serialize a session while it's being uploaded.
+type UploadSession struct {
+	mu   sync.Mutex
+	data sessionData
+}
+
+type sessionData struct {
+	Version   int    `json:"version"`
+	Namespace string `json:"namespace"`
+	Filename  string `json:"filename"`
+	Size      int64  `json:"size"`
+	ChunkSize int64  `json:"chunk_size"`
+	// Chunks have empty keys until they are accepted
+	Chunks []ManifestChunk `json:"chunks"`
+	// Key is a key of the manifest once the upload is complete
+	Key string `json:"key,omitempty"`
+}
+
+// NewUploadSession starts a session to upload size bytes as filename in chunks of chunkSize.
+// DefaultChunkSize is used if chunkSize is not set.
+func NewUploadSession(namespace, filename string, size, chunkSize int64) (*UploadSession, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("invalid size %d: must not be negative", size)
+	}
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	data := sessionData{
+		Version:   sessionVersion,
+		Namespace: namespace,
+		Filename:  filename,
+		Size:      size,
+		ChunkSize: chunkSize,
+	}
+	for offset := int64(0); offset < size; offset += chunkSize {
+		chunk := ManifestChunk{Size: chunkSize}
+		if size-offset < chunkSize {
+			chunk.Size = size - offset
+		}
+		data.Chunks = append(data.Chunks, chunk)
+	}
+	return &UploadSession{data: data}, nil
+}
+
+// RestoreUploadSession restores a session saved by Serialize
+func RestoreUploadSession(serialized []byte) (*UploadSession, error) {
+	var data sessionData
+	if err := json.Unmarshal(serialized, &data); err != nil {
+		return nil, fmt.Errorf("malformed upload session: %v", err)
+	}
+	if data.Version != sessionVersion {
+		return nil, fmt.Errorf("unsupported version of upload session: %d", data.Version)
+	}
+
+	if data.ChunkSize <= 0 || data.Size < 0 {
+		return nil, fmt.Errorf("malformed upload session: size %d, chunk size %d", data.Size, data.ChunkSize)
+	}
+	// chunks are read at n*ChunkSize, so they must be laid out exactly like NewUploadSession does
+	if chunks := (data.Size + data.ChunkSize - 1) / data.ChunkSize; int64(len(data.Chunks)) != chunks {
+		return nil, fmt.Errorf("malformed upload session: %d chunks instead of %d", len(data.Chunks), chunks)
+	}
+	for n, chunk := range data.Chunks {
+		size := data.ChunkSize
+		if rest := data.Size - int64(n)*data.ChunkSize; rest < size {
+			size = rest
+		}
+		if chunk.Size != size {
+			return nil, fmt.Errorf("malformed upload session: chunk %d has %d bytes instead of %d", n, chunk.Size, size)
+		}
+	}
+	return &UploadSession{data: data}, nil
+}
+
+// Serialize returns a state of the session to be restored with RestoreUploadSession
+func (s *UploadSession) Serialize() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return json.Marshal(&s.data)
+}
+
+// Accepted returns a number of bytes accepted by the proxy
+func (s *UploadSession) Accepted() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var accepted int64
+	for _, chunk := range s.data.Chunks {
+		if chunk.Key != "" {
+			accepted += chunk.Size
+		}
+	}
+	return accepted
+}
+
+// Key returns a key of the uploaded object to be passed to OpenLarge.
+// It's empty until the upload is complete.
+func (s *UploadSession) Key() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Key
+}
+
+// missing returns indexes of chunks not accepted yet
+func (s *UploadSession) missing() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var missing []int
+	for n, chunk := range s.data.Chunks {
+		if chunk.Key == "" {
+			missing = append(missing, n)
+		}
+	}
+	return missing
+}
+
+// ResumeUpload uploads chunks of session missing so far reading them from body,
+// which must provide the same data on every call, e.g. a file.
+// Once all chunks are accepted, the manifest is uploaded, see LargeUpload.
+// A failure of a chunk doesn't stop others, so the session makes as much progress as possible.
+// ChunkSize of opts is ignored, the session has its own.
+// A complete session isn't uploaded again, UploadInfo with its Key is returned.
+func (m *Client) ResumeUpload(ctx context.Context, session *UploadSession, body io.ReaderAt, opts LargeUploadOptions) (*UploadInfo, error) {
+	opts = m.largeUploadDefaults(opts)
+
+	session.mu.Lock()
+	namespace, filename, key := session.data.Namespace, session.data.Filename, session.data.Key
+	session.mu.Unlock()
+	if key != "" {
+		return &UploadInfo{Key: key, Filename: filename}, nil
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		missing  = session.missing()
+	)
+	m.runBatch(ctx, len(missing), opts.Concurrency, func(i int, err error) {
+		if err == nil {
+			err = m.resumeChunk(ctx, session, missing[i], body, opts.Retry)
+		}
+		if err != nil {
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+		}
+	})
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	session.mu.Lock()
+	manifest := Manifest{
+		Version:   manifestVersion,
+		Size:      session.data.Size,
+		ChunkSize: session.data.ChunkSize,
+		Chunks:    append([]ManifestChunk(nil), session.data.Chunks...),
+	}
+	session.mu.Unlock()
+
+	info, err := m.uploadManifest(ctx, namespace, filename, &manifest, opts.Retry)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mu.Lock()
+	session.data.Key = info.Key
+	session.mu.Unlock()
+	return info, nil
+}
+
+// resumeChunk reads chunk n of session from body, uploads it and records its key
+func (m *Client) resumeChunk(ctx context.Context, session *UploadSession, n int, body io.ReaderAt, policy RetryPolicy) error {
+	session.mu.Lock()
+	namespace, filename := session.data.Namespace, session.data.Filename
+	offset, size := int64(n)*session.data.ChunkSize, session.data.Chunks[n].Size
+	session.mu.Unlock()
+
+	data := make([]byte, size)
+	read, err := body.ReadAt(data, offset)
+	if err == io.EOF && read == len(data) {
+		// ReadAt may report EOF along with the last bytes of the body
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("chunk %d: %w", n, err)
+	}
+
+	key, err := m.uploadChunk(ctx, namespace, filename, n, data, policy)
+	if err != nil {
+		return err
+	}
+
+	session.mu.Lock()
+	session.data.Chunks[n].Key = key
+	session.mu.Unlock()
+	return nil
+}
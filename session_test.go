@@ -0,0 +1,135 @@
+package mds
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestUploadSession(t *testing.T) {
+	srv := newStoreServer()
+	defer srv.Close()
+
+	cli := newTestClient(t, srv.Server)
+	cli.setClock(newFakeClock())
+	ctx := context.Background()
+
+	var uploads []string
+	srv.fail = func(filename string) int {
+		uploads = append(uploads, filename)
+		if filename == "big.chunk000001" {
+			return http.StatusBadGateway
+		}
+		return 0
+	}
+
+	blob := bytes.Repeat([]byte("TESTBLOB"), 100)
+	session, err := NewUploadSession("ns", "big", int64(len(blob)), 300)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	_, err = cli.ResumeUpload(ctx, session, bytes.NewReader(blob), LargeUploadOptions{Concurrency: 1})
+	var mErr MethodError
+	if assert.True(t, errors.As(err, &mErr), "%v", err) {
+		assert.Equal(t, http.StatusBadGateway, mErr.StatusCode)
+	}
+	assert.Equal(t, int64(500), session.Accepted())
+	assert.Empty(t, session.Key())
+
+	// the process restarts
+	serialized, err := session.Serialize()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	session, err = RestoreUploadSession(serialized)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, int64(500), session.Accepted())
+
+	srv.mu.Lock()
+	uploads = nil
+	srv.fail = func(filename string) int {
+		uploads = append(uploads, filename)
+		return 0
+	}
+	srv.mu.Unlock()
+
+	info, err := cli.ResumeUpload(ctx, session, bytes.NewReader(blob), LargeUploadOptions{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	srv.mu.Lock()
+	assert.Equal(t, []string{"big.chunk000001", "big"}, uploads)
+	srv.mu.Unlock()
+	assert.Equal(t, info.Key, session.Key())
+	assert.Equal(t, int64(len(blob)), session.Accepted())
+
+	// a complete session isn't uploaded again
+	srv.mu.Lock()
+	uploads = nil
+	srv.mu.Unlock()
+	again, err := cli.ResumeUpload(ctx, session, bytes.NewReader(blob), LargeUploadOptions{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, info.Key, again.Key)
+	}
+	srv.mu.Lock()
+	assert.Empty(t, uploads)
+	srv.mu.Unlock()
+
+	rd, _, err := cli.OpenLarge(ctx, "ns", session.Key())
+	if assert.NoError(t, err) {
+		body, err := ioutil.ReadAll(rd)
+		assert.NoError(t, err)
+		assert.Equal(t, blob, body)
+		rd.Close()
+	}
+}
+
+func TestUploadSessionShortBody(t *testing.T) {
+	srv := newStoreServer()
+	defer srv.Close()
+
+	session, err := NewUploadSession("ns", "big", 10, 4)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, err = newTestClient(t, srv.Server).ResumeUpload(context.Background(), session, strings.NewReader("TESTBLOB"), LargeUploadOptions{})
+	assert.Error(t, err)
+	assert.Equal(t, int64(8), session.Accepted())
+}
+
+func TestRestoreUploadSession(t *testing.T) {
+	for _, serialized := range []string{
+		``,
+		`{"version":2,"size":0,"chunk_size":4}`,
+		`{"version":1,"size":10,"chunk_size":4,"chunks":[{"size":4}]}`,
+		`{"version":1,"size":0,"chunk_size":0}`,
+		`{"version":1,"size":10,"chunk_size":4,"chunks":[{"size":2},{"size":4},{"size":4}]}`,
+		`{"version":1,"size":8,"chunk_size":4,"chunks":[{"size":4},{"size":4},{"size":0}]}`,
+	} {
+		_, err := RestoreUploadSession([]byte(serialized))
+		assert.Error(t, err, serialized)
+	}
+
+	_, err := NewUploadSession("ns", "big", -1, 4)
+	assert.Error(t, err)
+
+	for _, size := range []int64{0, 4, 10} {
+		session, err := NewUploadSession("ns", "big", size, 4)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		serialized, err := session.Serialize()
+		assert.NoError(t, err)
+		_, err = RestoreUploadSession(serialized)
+		assert.NoError(t, err, "size %d", size)
+	}
+}
@@ -0,0 +1,170 @@
+package mds
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Defaults used by NewTransport
+const (
+	DefaultDialTimeout           = 5 * time.Second
+	DefaultKeepAlive             = 30 * time.Second
+	DefaultTLSHandshakeTimeout   = 5 * time.Second
+	DefaultResponseHeaderTimeout = 30 * time.Second
+	DefaultIdleConnTimeout       = 90 * time.Second
+	DefaultMaxIdleConns          = 100
+	DefaultMaxIdleConnsPerHost   = 32
+)
+
+// TransportOptions tune a transport created by NewTransport.
+// Zero values are replaced with defaults.
+type TransportOptions struct {
+	DialTimeout         time.Duration
+	KeepAlive           time.Duration
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout limits waiting for a reply after a request is sent.
+	// It doesn't limit reading a body, so it's safe for big objects.
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	MaxIdleConns          int
+	// MaxIdleConnsPerHost is much higher than the default of net/http,
+	// because all requests usually go to a few proxy hosts.
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost caps connections to a single proxy host, including ones in use.
+	// Requests over the cap wait for a connection, until their context is done.
+	// Zero means no limit.
+	MaxConnsPerHost int
+
+	TLSClientConfig *tls.Config
+	// DisableHTTP2 keeps the transport on HTTP/1.1 over TLS.
+	DisableHTTP2 bool
+}
+
+// NewTransport creates a transport tuned for MDS workloads.
+// NewClient uses it with default options if no client is provided.
+// The transport could be customized further and passed to NewClient
+// within *http.Client.
+func NewTransport(opts TransportOptions) *http.Transport {
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = DefaultDialTimeout
+	}
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = DefaultKeepAlive
+	}
+	if opts.TLSHandshakeTimeout <= 0 {
+		opts.TLSHandshakeTimeout = DefaultTLSHandshakeTimeout
+	}
+	if opts.ResponseHeaderTimeout <= 0 {
+		opts.ResponseHeaderTimeout = DefaultResponseHeaderTimeout
+	}
+	if opts.IdleConnTimeout <= 0 {
+		opts.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+	if opts.MaxIdleConns <= 0 {
+		opts.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if opts.MaxIdleConnsPerHost <= 0 {
+		opts.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   opts.DialTimeout,
+		KeepAlive: opts.KeepAlive,
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       opts.TLSClientConfig,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     !opts.DisableHTTP2,
+	}
+}
+
+// withTransportOptions returns a copy of client with a transport customized
+// according to config. The client is returned as is if there is nothing to customize.
+func withTransportOptions(client *http.Client, config Config) (*http.Client, error) {
+	if config.RequestTimeout > 0 {
+		rclient := *client
+		rclient.Timeout = config.RequestTimeout
+		client = &rclient
+	}
+
+	if !config.EnableHTTP2 && config.DialContext == nil && config.MaxConnsPerHost <= 0 && config.TLSConfig == nil &&
+		config.DialTimeout <= 0 && config.TLSHandshakeTimeout <= 0 && config.ResponseHeaderTimeout <= 0 {
+		return client, nil
+	}
+
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport)
+	case *http.Transport:
+		transport = t
+	default:
+		return nil, fmt.Errorf("unable to customize transport %T", client.Transport)
+	}
+
+	transport = transport.Clone()
+	if config.EnableHTTP2 {
+		transport.ForceAttemptHTTP2 = true
+	}
+	if config.DialContext != nil {
+		transport.DialContext = config.DialContext
+	}
+	if config.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = config.MaxConnsPerHost
+	}
+	if config.TLSConfig != nil {
+		transport.TLSClientConfig = config.TLSConfig.Clone()
+	}
+	if config.DialTimeout > 0 {
+		dial := transport.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{KeepAlive: DefaultKeepAlive}).DialContext
+		}
+		transport.DialContext = withDialTimeout(dial, config.DialTimeout)
+	}
+	if config.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = config.TLSHandshakeTimeout
+	}
+	if config.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = config.ResponseHeaderTimeout
+	}
+
+	tclient := *client
+	tclient.Transport = transport
+	return &tclient, nil
+}
+
+// DialContext is a function to establish connections to a proxy
+type DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// withDialTimeout limits dial, so it works with any dialer including Config.DialContext
+func withDialTimeout(dial func(ctx context.Context, network, addr string) (net.Conn, error), timeout time.Duration) DialContext {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return dial(ctx, network, addr)
+	}
+}
+
+// CloseIdleConnections closes pooled keep-alive connections, which are not in use,
+// e.g. after a proxy is redeployed. Requests in flight are not affected,
+// their connections are closed once they become idle.
+// Subsequent requests establish new connections.
+// Note that idle connections of everyone sharing the transport are closed,
+// if the transport of a provided *http.Client is shared, e.g. http.DefaultTransport.
+func (m *Client) CloseIdleConnections() {
+	m.client.CloseIdleConnections()
+}
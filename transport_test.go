@@ -0,0 +1,395 @@
+package mds
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func newTLSServer(handler http.Handler) *httptest.Server {
+	srv := httptest.NewUnstartedServer(handler)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	return srv
+}
+
+func newTLSTestClient(tb testing.TB, srv *httptest.Server, enableHTTP2 bool) *Client {
+	// a custom TLS config makes the transport stick to HTTP/1.1 unless HTTP/2 is forced
+	tlsConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig
+	port := serverPort(tb, srv)
+	cli, err := NewClient(Config{
+		Host:        "https://127.0.0.1",
+		UploadPort:  port,
+		ReadPort:    port,
+		EnableHTTP2: enableHTTP2,
+	}, &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:     tlsConfig.Clone(),
+			MaxIdleConnsPerHost: 64,
+		},
+	})
+	if err != nil {
+		tb.Fatalf("unable to create client %+v", err)
+	}
+	return cli
+}
+
+func TestEnableHTTP2(t *testing.T) {
+	var proto int
+	srv := newTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.ProtoMajor
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	assert.NoError(t, newTLSTestClient(t, srv, false).Ping(ctx))
+	assert.Equal(t, 1, proto)
+
+	assert.NoError(t, newTLSTestClient(t, srv, true).Ping(ctx))
+	assert.Equal(t, 2, proto)
+}
+
+func TestEnableHTTP2CustomRoundTripper(t *testing.T) {
+	_, err := NewClient(Config{
+		Host:        "127.0.0.1",
+		EnableHTTP2: true,
+	}, &http.Client{Transport: roundTripperFunc(http.DefaultTransport.RoundTrip)})
+	assert.Error(t, err)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestCustomTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	var requests []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests = append(requests, req.URL.Path)
+		return http.DefaultTransport.RoundTrip(req)
+	})
+
+	port := serverPort(t, srv)
+	cli, err := NewClient(Config{
+		Host:       "127.0.0.1",
+		UploadPort: port,
+		ReadPort:   port,
+		Transport:  transport,
+	}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.NoError(t, cli.Ping(context.Background()))
+	assert.Equal(t, []string{"/ping"}, requests)
+
+	_, err = NewClient(Config{Host: "127.0.0.1", Transport: transport}, &http.Client{})
+	assert.Error(t, err)
+}
+
+func benchmarkSmallGets(b *testing.B, enableHTTP2 bool) {
+	body := []byte("TESTBLOB")
+	srv := newTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	cli := newTLSTestClient(b, srv, enableHTTP2)
+	ctx := context.Background()
+
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rd, err := cli.Get(ctx, "ns", "1/key")
+			if err != nil {
+				b.Fatal(err)
+			}
+			io.Copy(ioutil.Discard, rd)
+			rd.Close()
+		}
+	})
+}
+
+func BenchmarkSmallGetsHTTP1(b *testing.B) {
+	benchmarkSmallGets(b, false)
+}
+
+func BenchmarkSmallGetsHTTP2(b *testing.B) {
+	benchmarkSmallGets(b, true)
+}
+
+func TestDialContext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	var dialed []string
+	var dialer net.Dialer
+	port := serverPort(t, srv)
+	cli, err := NewClient(Config{
+		Host:       "proxy.invalid",
+		UploadPort: port,
+		ReadPort:   port,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = append(dialed, addr)
+			// route the unresolvable host to the test server
+			return dialer.DialContext(ctx, network, srv.Listener.Addr().String())
+		},
+	}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	assert.NoError(t, cli.Ping(context.Background()))
+	assert.Equal(t, []string{fmt.Sprintf("proxy.invalid:%d", port)}, dialed)
+	// compare identities, a deep comparison would race with connections of the transport
+	assert.True(t, http.DefaultTransport != cli.client.Transport)
+}
+
+func TestMaxConnsPerHost(t *testing.T) {
+	const maxConns = 2
+	var conns, maxSeen int32
+	var delay = int64(10 * time.Millisecond)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Duration(atomic.LoadInt64(&delay)))
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			n := atomic.AddInt32(&conns, 1)
+			for {
+				max := atomic.LoadInt32(&maxSeen)
+				if n <= max || atomic.CompareAndSwapInt32(&maxSeen, max, n) {
+					break
+				}
+			}
+		case http.StateClosed, http.StateHijacked:
+			atomic.AddInt32(&conns, -1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	port := serverPort(t, srv)
+	cli, err := NewClient(Config{
+		Host:            "127.0.0.1",
+		UploadPort:      port,
+		ReadPort:        port,
+		MaxConnsPerHost: maxConns,
+	}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, maxConns, cli.client.Transport.(*http.Transport).MaxConnsPerHost)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, cli.Ping(context.Background()))
+		}()
+	}
+	wg.Wait()
+	assert.True(t, atomic.LoadInt32(&maxSeen) <= maxConns)
+
+	// a request waiting for a connection gives up with its context
+	atomic.StoreInt64(&delay, int64(100*time.Millisecond))
+	for i := 0; i < maxConns; i++ {
+		go cli.Ping(context.Background())
+	}
+	time.Sleep(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, cli.Ping(ctx))
+}
+
+func TestCloseIdleConnections(t *testing.T) {
+	var conns int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	assert.NoError(t, cli.Ping(ctx))
+	assert.NoError(t, cli.Ping(ctx))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conns))
+
+	cli.CloseIdleConnections()
+	assert.NoError(t, cli.Ping(ctx))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&conns))
+}
+
+func TestNewTransport(t *testing.T) {
+	transport := NewTransport(TransportOptions{})
+	assert.Equal(t, DefaultTLSHandshakeTimeout, transport.TLSHandshakeTimeout)
+	assert.Equal(t, DefaultResponseHeaderTimeout, transport.ResponseHeaderTimeout)
+	assert.Equal(t, DefaultIdleConnTimeout, transport.IdleConnTimeout)
+	assert.Equal(t, DefaultMaxIdleConns, transport.MaxIdleConns)
+	assert.Equal(t, DefaultMaxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+	assert.True(t, transport.ForceAttemptHTTP2)
+
+	transport = NewTransport(TransportOptions{
+		ResponseHeaderTimeout: time.Minute,
+		MaxIdleConnsPerHost:   4,
+		DisableHTTP2:          true,
+	})
+	assert.Equal(t, time.Minute, transport.ResponseHeaderTimeout)
+	assert.Equal(t, 4, transport.MaxIdleConnsPerHost)
+	assert.False(t, transport.ForceAttemptHTTP2)
+}
+
+func TestNewClientDefaultTransport(t *testing.T) {
+	cli, err := NewClient(Config{Host: "proxy.net"}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	transport, ok := cli.client.Transport.(*http.Transport)
+	if assert.True(t, ok) {
+		assert.Equal(t, DefaultMaxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+	}
+}
+
+func TestNewTransportHTTP2(t *testing.T) {
+	var proto int
+	srv := newTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.ProtoMajor
+	}))
+	defer srv.Close()
+
+	tlsConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig
+	port := serverPort(t, srv)
+	for _, disable := range []bool{false, true} {
+		cli, err := NewClient(Config{
+			Host:       "https://127.0.0.1",
+			UploadPort: port,
+			ReadPort:   port,
+		}, &http.Client{
+			Transport: NewTransport(TransportOptions{
+				TLSClientConfig: tlsConfig.Clone(),
+				DisableHTTP2:    disable,
+			}),
+		})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+
+		assert.NoError(t, cli.Ping(context.Background()))
+		if disable {
+			assert.Equal(t, 1, proto)
+		} else {
+			assert.Equal(t, 2, proto)
+		}
+	}
+}
+
+func TestUseTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	// the server certificate is signed by a CA unknown to the system
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	port := serverPort(t, srv)
+	cli, err := New("127.0.0.1", WithPorts(port, port), WithTLS(&tls.Config{RootCAs: roots}))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "https://127.0.0.1", cli.Host)
+	assert.NoError(t, cli.Ping(context.Background()))
+
+	cli, err = New("127.0.0.1", WithPorts(port, port), WithTLS(nil))
+	if assert.NoError(t, err) {
+		assert.Error(t, cli.Ping(context.Background()))
+	}
+
+	_, err = New("http://127.0.0.1", WithTLS(nil))
+	assert.Error(t, err)
+	_, err = New("127.0.0.1", WithTLS(nil), WithDeleteEndpoint("http://127.0.0.2", 0))
+	assert.Error(t, err)
+	_, err = New("", WithTLS(nil), WithHosts("127.0.0.1", "http://127.0.0.2"))
+	assert.Error(t, err)
+}
+
+func TestTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/get-ns/1/slow-body" {
+			w.Write([]byte("TEST"))
+			w.(http.Flusher).Flush()
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	port := serverPort(t, srv)
+	newClient := func(cfg Config) *Client {
+		cfg.Host = "127.0.0.1"
+		cfg.UploadPort = port
+		cfg.ReadPort = port
+		cli, err := NewClient(cfg, nil)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return cli
+	}
+	ctx := context.Background()
+
+	cli := newClient(Config{ResponseHeaderTimeout: 20 * time.Millisecond})
+	transport := cli.client.Transport.(*http.Transport)
+	assert.Equal(t, 20*time.Millisecond, transport.ResponseHeaderTimeout)
+	assert.Equal(t, DefaultTLSHandshakeTimeout, transport.TLSHandshakeTimeout)
+	assert.Error(t, cli.Ping(ctx))
+
+	cli = newClient(Config{RequestTimeout: 20 * time.Millisecond})
+	assert.Equal(t, 20*time.Millisecond, cli.client.Timeout)
+	rd, err := cli.Get(ctx, "ns", "1/slow-body")
+	if assert.NoError(t, err) {
+		_, err = ioutil.ReadAll(rd)
+		assert.Error(t, err)
+		rd.Close()
+	}
+
+	// the dial timeout applies to a custom dialer as well
+	cli = newClient(Config{
+		DialTimeout:         20 * time.Millisecond,
+		TLSHandshakeTimeout: time.Second,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+	assert.Equal(t, time.Second, cli.client.Transport.(*http.Transport).TLSHandshakeTimeout)
+	start := time.Now()
+	assert.Error(t, cli.Ping(ctx))
+	assert.True(t, time.Since(start) < time.Second)
+}
@@ -0,0 +1,141 @@
+package mds
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// UploadOption tunes a single upload
+type UploadOption func(*uploadOptions)
+
+type uploadOptions struct {
+	expire   time.Duration
+	checksum hash.Hash
+}
+
+// WithExpire makes the proxy remove an object after d.
+// It's passed as expire parameter of the upload rounded up to seconds.
+func WithExpire(d time.Duration) UploadOption {
+	return func(o *uploadOptions) {
+		o.expire = d
+	}
+}
+
+// WithChecksum feeds h with a body as it's sent, so a checksum is computed
+// without another pass over the data, e.g. WithChecksum(sha256.New()).
+// The sum is complete only if the upload succeeds.
+func WithChecksum(h hash.Hash) UploadOption {
+	return func(o *uploadOptions) {
+		o.checksum = h
+	}
+}
+
+// withChecksum feeds h with a body of req as it's sent.
+// A body sent again, e.g. to another of Hosts, is hashed from scratch.
+func withChecksum(req *http.Request, h hash.Hash) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return
+	}
+	req.Body = teeBody(req.Body, h)
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			h.Reset()
+			return teeBody(body, h), nil
+		}
+	}
+}
+
+func teeBody(body io.ReadCloser, w io.Writer) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(body, w), body}
+}
+
+func newUploadOptions(opts []UploadOption) uploadOptions {
+	var o uploadOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// query returns query parameters of an upload
+func (o *uploadOptions) query() (url.Values, error) {
+	query := make(url.Values)
+	if o.expire < 0 {
+		return nil, fmt.Errorf("invalid expire %v: must not be negative", o.expire)
+	}
+	if o.expire > 0 {
+		seconds := (o.expire + time.Second - 1) / time.Second
+		query.Set("expire", fmt.Sprintf("%ds", seconds))
+	}
+	return query, nil
+}
+
+// countingReader counts bytes read from an upload body.
+// The transport reads the body in its own goroutine, hence atomics.
+type countingReader struct {
+	io.ReadCloser
+
+	n   int64
+	eof int32
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+	if err == io.EOF {
+		atomic.StoreInt32(&r.eof, 1)
+	}
+	return n, err
+}
+
+func (r *countingReader) count() int64 {
+	return atomic.LoadInt64(&r.n)
+}
+
+// mismatch reports whether the body turned out to be shorter
+// or longer than size. A body which is not read till the end
+// because of another failure is not a mismatch.
+func (r *countingReader) mismatch(size int64) bool {
+	n := r.count()
+	return n > size || (n < size && atomic.LoadInt32(&r.eof) == 1)
+}
+
+// UploadFile uploads a file at path like Upload, the size is taken from the file.
+// See WithChecksum to compute a checksum of the file while it's sent.
+func (m *Client) UploadFile(ctx context.Context, namespace, filename, path string, opts ...UploadOption) (*UploadInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+
+	var body io.Reader = file
+	if fi.Size() == 0 {
+		// an empty body of unknown type would be sent chunked
+		body = http.NoBody
+	}
+	return m.Upload(ctx, namespace, filename, fi.Size(), body, opts...)
+}
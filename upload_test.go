@@ -0,0 +1,199 @@
+package mds
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// opaqueReader hides the type of a reader, so the size is not guessed by http.NewRequest
+type opaqueReader struct {
+	io.Reader
+}
+
+func TestUploadSizeMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		io.WriteString(w, uploadReply)
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	_, err := cli.Upload(ctx, "ns", "file", 10, opaqueReader{strings.NewReader("TEST")})
+	assert.True(t, errors.Is(err, ErrSizeMismatch), "%v", err)
+	var sErr SizeMismatchError
+	if assert.True(t, errors.As(err, &sErr)) {
+		assert.Equal(t, int64(10), sErr.Declared)
+		assert.Equal(t, int64(4), sErr.Observed)
+	}
+
+	_, err = cli.Upload(ctx, "ns", "file", 2, opaqueReader{strings.NewReader("TEST")})
+	assert.True(t, errors.Is(err, ErrSizeMismatch), "%v", err)
+
+	_, err = cli.Upload(ctx, "ns", "file", 4, opaqueReader{strings.NewReader("TEST")})
+	assert.NoError(t, err)
+}
+
+func TestUploadFailureIsNotSizeMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	cli := newTestClient(t, srv)
+	srv.Close()
+
+	_, err := cli.Upload(context.Background(), "ns", "file", 4, opaqueReader{strings.NewReader("TEST")})
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrSizeMismatch))
+}
+
+func TestUploadSuccessStatuses(t *testing.T) {
+	var status int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		if status != http.StatusNoContent {
+			io.WriteString(w, uploadReply)
+		}
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	for _, status = range []int{http.StatusOK, http.StatusCreated, http.StatusAccepted} {
+		info, err := cli.Upload(ctx, "ns", "file", 4, strings.NewReader("TEST"))
+		if assert.NoError(t, err, "status %d", status) {
+			assert.Equal(t, "3402/file", info.Key)
+		}
+	}
+
+	status = http.StatusNoContent
+	info, err := cli.Upload(ctx, "ns", "file", 4, strings.NewReader("TEST"))
+	assert.True(t, errors.Is(err, ErrNoKey), "%v", err)
+	if assert.NotNil(t, info) {
+		assert.Equal(t, "file", info.Filename)
+		assert.Empty(t, info.Key)
+	}
+
+	// callers never get an empty key
+	_, _, err = cli.UploadAndSign(ctx, "ns", "file", 4, strings.NewReader("TEST"))
+	assert.True(t, errors.Is(err, ErrNoKey), "%v", err)
+
+	status = http.StatusMultipleChoices
+	_, err = cli.Upload(ctx, "ns", "file", 4, strings.NewReader("TEST"))
+	assert.Error(t, err)
+}
+
+func TestUploadCreatedRequiresBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	_, err := newTestClient(t, srv).Upload(context.Background(), "ns", "file", 4, strings.NewReader("TEST"))
+	assert.Error(t, err)
+}
+
+func TestUploadPayloadTooLarge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}))
+	defer srv.Close()
+
+	_, err := newTestClient(t, srv).Upload(context.Background(), "ns", "file", 4, strings.NewReader("TEST"))
+	assert.True(t, errors.Is(err, ErrPayloadTooLarge), "%v", err)
+	var mErr MethodError
+	if assert.True(t, errors.As(err, &mErr)) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, mErr.StatusCode)
+	}
+}
+
+func TestUploadWithExpire(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		io.WriteString(w, uploadReply)
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		expire time.Duration
+		query  string
+	}{
+		{0, ""},
+		{time.Hour, "expire=3600s"},
+		{1500 * time.Millisecond, "expire=2s"},
+	} {
+		_, err := cli.Upload(ctx, "ns", "file", 4, strings.NewReader("TEST"), WithExpire(tc.expire))
+		assert.NoError(t, err)
+		assert.Equal(t, tc.query, query, "%v", tc.expire)
+	}
+
+	query = ""
+	_, err := cli.Upload(ctx, "ns", "file", 4, strings.NewReader("TEST"), WithExpire(-time.Second))
+	assert.Error(t, err)
+
+	results := cli.UploadMany(ctx, "ns", []UploadItem{{Filename: "file", Size: 4, Body: strings.NewReader("TEST")}}, WithExpire(time.Minute))
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, "expire=60s", query)
+}
+
+func TestUploadFile(t *testing.T) {
+	var body []byte
+	var contentLength int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+		body, _ = ioutil.ReadAll(r.Body)
+		io.WriteString(w, uploadReply)
+	}))
+	defer srv.Close()
+
+	cli := newTestClient(t, srv)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "mds-upload")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "file")
+	if !assert.NoError(t, ioutil.WriteFile(path, []byte("TESTBLOB"), 0644)) {
+		t.FailNow()
+	}
+
+	h := sha256.New()
+	info, err := cli.UploadFile(ctx, "ns", "file", path, WithChecksum(h))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "file", info.Filename)
+	}
+	assert.Equal(t, "TESTBLOB", string(body))
+	assert.Equal(t, int64(8), contentLength)
+	sum := sha256.Sum256([]byte("TESTBLOB"))
+	assert.Equal(t, sum[:], h.Sum(nil))
+
+	empty := filepath.Join(dir, "empty")
+	if assert.NoError(t, ioutil.WriteFile(empty, nil, 0644)) {
+		_, err = cli.UploadFile(ctx, "ns", "empty", empty)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), contentLength)
+	}
+
+	_, err = cli.UploadFile(ctx, "ns", "file", filepath.Join(dir, "missing"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = cli.UploadFile(ctx, "ns", "file", dir)
+	assert.Error(t, err)
+}
@@ -2,10 +2,12 @@ package mds
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"testing"
 	"time"
 
@@ -50,6 +52,46 @@ func TestDecodeUploadInfo(t *testing.T) {
 	assert.Equal(t, 2, info.Written)
 }
 
+func TestDecodeUploadInfoRootVariants(t *testing.T) {
+	for _, root := range []string{"post", "upload"} {
+		body := []byte(`<?xml version="1.0" encoding="utf-8"?>
+<` + root + ` obj="sandbox-tmp.file1" id="0:48f22774edb9...7727258a3cee" groups="1" size="4" key="3402/file1">
+<complete addr="192.168.1.2:1025" path="/srv/storage/60/2/data-0.0" group="3402" status="0"/>
+<written>1</written>
+</` + root + `>`)
+		var info UploadInfo
+		if !assert.NoError(t, decodeXML(&info, bytes.NewReader(body)), root) {
+			continue
+		}
+		assert.Equal(t, root, info.XMLName.Local)
+		assert.Equal(t, "3402/file1", info.Key)
+		assert.Equal(t, uint64(4), info.Size)
+		assert.Equal(t, 1, len(info.Complete))
+		assert.Equal(t, 1, info.Written)
+	}
+
+	var info UploadInfo
+	err := decodeXML(&info, bytes.NewReader([]byte(`<download-info><host>h</host></download-info>`)))
+	assert.Error(t, err)
+}
+
+func TestHealthyReplica(t *testing.T) {
+	info := UploadInfo{
+		Complete: []Replica{
+			{Addr: "192.168.1.1:1025", Path: "/srv/storage/47/1/data-0.0", Group: 4643, Status: -110},
+			{Addr: "192.168.1.2:1025", Path: "/srv/storage/60/2/data-0.0", Group: 3402, Status: 0},
+		},
+	}
+
+	replica, ok := info.HealthyReplica()
+	assert.True(t, ok)
+	assert.Equal(t, info.Complete[1], replica)
+
+	info.Complete = info.Complete[:1]
+	_, ok = info.HealthyReplica()
+	assert.False(t, ok)
+}
+
 func TestDecodeDirectURLInfo(t *testing.T) {
 	body := []byte(`<?xml version="1.0" encoding="utf-8"?>
 <download-info>
@@ -71,6 +113,69 @@ func TestDecodeDirectURLInfo(t *testing.T) {
 	assert.Equal(t, "d4befea37cf3ae9712775c26a9d491fd067a2932fe4b5142ac781f2cc379f11a", info.Sign)
 }
 
+func TestDownloadInfoURL(t *testing.T) {
+	info := DownloadInfo{
+		Host: "storage-direct.hosts.net",
+		Path: "/books-internal/21/2/data-0.1:42968596189:2077462",
+		TS:   "50b5c7ad2accf",
+		Sign: "d4befea37cf3ae97",
+	}
+	assert.Equal(t, "http://storage-direct.hosts.net/books-internal/21/2/data-0.1:42968596189:2077462?ts=50b5c7ad2accf&sign=d4befea37cf3ae97", info.URL())
+}
+
+func TestDownloadInfoRegionURL(t *testing.T) {
+	info := DownloadInfo{
+		Host:   "storage-direct.hosts.net",
+		Path:   "/ns/21/2/data-0.1:42968596189:2077462",
+		TS:     "50b5c7ad2accf",
+		Region: 9,
+		Sign:   "d4befea37cf3ae97",
+	}
+	regionHost := RegionHostTemplate("cdn-{region}.example.net")
+	assert.Equal(t, "cdn-9.example.net", regionHost(9))
+	assert.Equal(t, "http://cdn-9.example.net/ns/21/2/data-0.1:42968596189:2077462?ts=50b5c7ad2accf&sign=d4befea37cf3ae97", info.RegionURL(regionHost))
+	assert.Equal(t, info.URL(), info.RegionURL(nil))
+	assert.Equal(t, info.URL(), info.RegionURL(func(int) string { return "" }))
+
+	info.Region = -1
+	assert.Equal(t, info.URL(), info.RegionURL(regionHost))
+}
+
+func TestVerifyDownloadInfo(t *testing.T) {
+	signedAt := time.Now().Add(-time.Hour)
+	info := DownloadInfo{
+		Host: "storage-direct.hosts.net",
+		Path: "/ns/21/2/data-0.1:42968596189:2077462",
+		TS:   strconv.FormatInt(signedAt.UnixNano()/1e3, 16),
+		Sign: "d4befea37cf3ae97",
+	}
+	assert.NoError(t, VerifyDownloadInfo(&info, 0))
+	assert.NoError(t, VerifyDownloadInfo(&info, 2*time.Hour))
+	assert.True(t, errors.Is(VerifyDownloadInfo(&info, time.Minute), ErrSignatureExpired))
+
+	for _, broken := range []DownloadInfo{
+		{Host: info.Host, Path: info.Path, TS: info.TS},
+		{Host: info.Host, Path: info.Path, TS: info.TS, Sign: "xyz"},
+		{Host: info.Host, Path: info.Path, TS: "xyz", Sign: info.Sign},
+		{Path: info.Path, TS: info.TS, Sign: info.Sign},
+	} {
+		assert.True(t, errors.Is(VerifyDownloadInfo(&broken, 0), ErrSignatureInvalid), "%+v", broken)
+	}
+}
+
+func TestDownloadInfoTimestamp(t *testing.T) {
+	info := DownloadInfo{TS: "50b5c7ad2accf"}
+	ts, err := info.Timestamp()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2014, time.December, 29, 15, 25, 9, 77199000, time.UTC), ts.UTC())
+
+	for _, malformed := range []string{"", "xyz", "-50b5c7ad2accf", "ffffffffffffffffff"} {
+		info.TS = malformed
+		_, err = info.Timestamp()
+		assert.Error(t, err, malformed)
+	}
+}
+
 func TestUploadAndGet(t *testing.T) {
 	const (
 		namespace = "sandbox-tmp"
@@ -0,0 +1,170 @@
+package mds
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// URL builders below do not depend on a Client,
+// so they could be used by tools which only need to construct links.
+// Client uses them as well, so links always match.
+
+// UploadURLFor returns a URL to upload filename to namespace.
+func UploadURLFor(cfg Config, namespace, filename string) string {
+	return endpoint(cfg, cfg.Host, cfg.UploadPort, "upload-"+escapePath(namespace), filename)
+}
+
+// ReadURLFor returns a URL to read key from namespace.
+func ReadURLFor(cfg Config, namespace, key string) string {
+	return endpoint(cfg, cfg.Host, cfg.ReadPort, "get-"+escapePath(namespace), key)
+}
+
+// DeleteURLFor returns a URL to delete key from namespace
+// according to DeleteHost, DeletePort and DeleteMode of cfg.
+func DeleteURLFor(cfg Config, namespace, key string) string {
+	return deleteURLFor(cfg, namespace, key, cfg.DeleteMode)
+}
+
+// DownloadInfoURLFor returns a URL to retrieve DownloadInfo of key.
+func DownloadInfoURLFor(cfg Config, namespace, key string) string {
+	return endpoint(cfg, cfg.Host, cfg.ReadPort, "downloadinfo-"+escapePath(namespace), key)
+}
+
+// PingURLFor returns a URL to check availability of a proxy.
+func PingURLFor(cfg Config) string {
+	return endpoint(cfg, cfg.Host, cfg.ReadPort, "ping", "")
+}
+
+func deleteURLFor(cfg Config, namespace, key string, mode DeleteMode) string {
+	host, port := cfg.Host, cfg.UploadPort
+	if cfg.DeleteHost != "" {
+		host = cfg.DeleteHost
+	}
+	if cfg.DeletePort != 0 {
+		port = cfg.DeletePort
+	}
+
+	urlStr := endpoint(cfg, host, port, "delete-"+escapePath(namespace), key)
+	if mode == SoftDelete && cfg.SoftDeleteQuery != "" {
+		urlStr += "?" + cfg.SoftDeleteQuery
+	}
+	return urlStr
+}
+
+func endpoint(cfg Config, host string, port int, handle, key string) string {
+	urlStr := fmt.Sprintf("%s:%d/%s", withScheme(host, cfg.UseTLS), port, handle)
+	if key != "" {
+		urlStr += "/" + escapePath(key)
+	}
+	return urlStr
+}
+
+// validateHostHeader checks that host is a valid host[:port]
+func validateHostHeader(host string) error {
+	u, err := url.Parse("http://" + host)
+	if err != nil || u.Host != host || u.Hostname() == "" || u.User != nil {
+		return fmt.Errorf("invalid HostHeader %q: must be host[:port]", host)
+	}
+	return nil
+}
+
+// withScheme adds a scheme to host unless it has one: https if useTLS is set, http otherwise
+func withScheme(host string, useTLS bool) string {
+	if hasScheme(host) {
+		return host
+	}
+	if useTLS {
+		return "https://" + host
+	}
+	return "http://" + host
+}
+
+func hasScheme(host string) bool {
+	return strings.HasPrefix(host, "http://") || strings.HasPrefix(host, "https://")
+}
+
+// checkScheme rejects host with an explicit plain http scheme if useTLS is set
+func checkScheme(host string, useTLS bool) error {
+	if useTLS && strings.HasPrefix(host, "http://") {
+		return fmt.Errorf("host %q has http scheme, but UseTLS is set", host)
+	}
+	return nil
+}
+
+// escapePath escapes every segment of a slash separated path,
+// keeping slashes as is, because keys look like group/filename.
+func escapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+type endpointOverride struct {
+	host string
+	port int
+}
+
+type endpointContextKey struct{}
+
+// WithEndpoint returns a copy of ctx making requests go to host and port
+// instead of configured ones, e.g. to try a canary proxy with a single call.
+// An empty host or a zero port keep configured values.
+// The port replaces upload, read and delete ports alike.
+func WithEndpoint(ctx context.Context, host string, port int) context.Context {
+	return context.WithValue(ctx, endpointContextKey{}, endpointOverride{host: host, port: port})
+}
+
+// config returns Config of the client with an endpoint override from ctx applied
+func (m *Client) config(ctx context.Context) Config {
+	cfg := m.Config
+	override, ok := ctx.Value(endpointContextKey{}).(endpointOverride)
+	if !ok || override.host == "" {
+		if m.hosts != nil {
+			cfg.Host = m.hosts.pick()
+		}
+	}
+	if !ok {
+		return cfg
+	}
+
+	if override.host != "" {
+		cfg.Host = withScheme(override.host, cfg.UseTLS)
+		cfg.DeleteHost = ""
+	}
+	if override.port != 0 {
+		cfg.UploadPort = override.port
+		cfg.ReadPort = override.port
+		cfg.DeletePort = override.port
+	}
+	return cfg
+}
+
+func (m *Client) uploadURL(ctx context.Context, namespace, filename string) string {
+	return UploadURLFor(m.config(ctx), namespace, filename)
+}
+
+func (m *Client) readURL(ctx context.Context, namespace, key string) string {
+	return ReadURLFor(m.config(ctx), namespace, key)
+}
+
+func (m *Client) deleteURL(ctx context.Context, namespace, key string, mode DeleteMode) string {
+	return deleteURLFor(m.config(ctx), namespace, key, mode)
+}
+
+func (m *Client) pingURL(ctx context.Context) string {
+	return PingURLFor(m.config(ctx))
+}
+
+func (m *Client) downloadinfoURL(ctx context.Context, namespace, key string) string {
+	return DownloadInfoURLFor(m.config(ctx), namespace, key)
+}
+
+func (m *Client) getRealURL(ctx context.Context) string {
+	cfg := m.config(ctx)
+	return endpoint(cfg, cfg.Host, cfg.UploadPort, "hostname", "")
+}
@@ -0,0 +1,143 @@
+package mds
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestURLFor(t *testing.T) {
+	cfg := Config{
+		Host:       "proxy.net",
+		UploadPort: 1111,
+		ReadPort:   80,
+	}
+
+	assert.Equal(t, "http://proxy.net:1111/upload-ns/file", UploadURLFor(cfg, "ns", "file"))
+	assert.Equal(t, "http://proxy.net:80/get-ns/1/file", ReadURLFor(cfg, "ns", "1/file"))
+	assert.Equal(t, "http://proxy.net:1111/delete-ns/1/file", DeleteURLFor(cfg, "ns", "1/file"))
+	assert.Equal(t, "http://proxy.net:80/downloadinfo-ns/1/file", DownloadInfoURLFor(cfg, "ns", "1/file"))
+	assert.Equal(t, "http://proxy.net:80/ping", PingURLFor(cfg))
+
+	cfg.Host = "https://proxy.net"
+	assert.Equal(t, "https://proxy.net:80/get-ns/1/file", ReadURLFor(cfg, "ns", "1/file"))
+
+	cfg.Host = "proxy.net"
+	cfg.DeleteHost = "delete.proxy.net"
+	cfg.UseTLS = true
+	assert.Equal(t, "https://proxy.net:1111/upload-ns/file", UploadURLFor(cfg, "ns", "file"))
+	assert.Equal(t, "https://delete.proxy.net:1111/delete-ns/1/file", DeleteURLFor(cfg, "ns", "1/file"))
+}
+
+func TestURLForEscaping(t *testing.T) {
+	cfg := Config{
+		Host:       "proxy.net",
+		UploadPort: 1111,
+		ReadPort:   80,
+	}
+
+	assert.Equal(t, "http://proxy.net:1111/upload-ns/my%20file%3F.txt", UploadURLFor(cfg, "ns", "my file?.txt"))
+	assert.Equal(t, "http://proxy.net:80/get-ns/1/my%20file%3F.txt", ReadURLFor(cfg, "ns", "1/my file?.txt"))
+	assert.Equal(t, "http://proxy.net:80/get-ns/1/a%23b", ReadURLFor(cfg, "ns", "1/a#b"))
+}
+
+func TestClientURLsMatchURLFor(t *testing.T) {
+	cfg := Config{
+		Host:       "proxy.net",
+		UploadPort: 1111,
+		ReadPort:   80,
+	}
+	cli, err := NewClient(cfg, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	ctx := context.Background()
+	assert.Equal(t, UploadURLFor(cfg, "ns", "a b"), cli.uploadURL(ctx, "ns", "a b"))
+	assert.Equal(t, DeleteURLFor(cfg, "ns", "1/a b"), cli.deleteURL(ctx, "ns", "1/a b", HardDelete))
+	assert.Equal(t, DownloadInfoURLFor(cfg, "ns", "1/a b"), cli.downloadinfoURL(ctx, "ns", "1/a b"))
+	assert.Equal(t, PingURLFor(cfg), cli.pingURL(ctx))
+
+	rawurl, err := cli.ReadURL(ctx, "ns", "1/a b", false)
+	assert.NoError(t, err)
+	assert.Equal(t, ReadURLFor(cfg, "ns", "1/a b"), rawurl)
+}
+
+func TestWithEndpoint(t *testing.T) {
+	cli, err := NewClient(Config{
+		Host:       "proxy.net",
+		UploadPort: 1111,
+		ReadPort:   80,
+		DeleteHost: "delete.proxy.net",
+		DeletePort: 8080,
+	}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	ctx := WithEndpoint(context.Background(), "canary.net", 0)
+	assert.Equal(t, "http://canary.net:1111/upload-ns/file", cli.uploadURL(ctx, "ns", "file"))
+	assert.Equal(t, "http://canary.net:80/get-ns/1/file", cli.readURL(ctx, "ns", "1/file"))
+	assert.Equal(t, "http://canary.net:8080/delete-ns/1/file", cli.deleteURL(ctx, "ns", "1/file", HardDelete))
+
+	ctx = WithEndpoint(context.Background(), "", 9999)
+	assert.Equal(t, "http://proxy.net:9999/upload-ns/file", cli.uploadURL(ctx, "ns", "file"))
+	assert.Equal(t, "http://proxy.net:9999/ping", cli.pingURL(ctx))
+	assert.Equal(t, "http://delete.proxy.net:9999/delete-ns/1/file", cli.deleteURL(ctx, "ns", "1/file", HardDelete))
+
+	// the client config is intact
+	assert.Equal(t, "http://proxy.net:1111/upload-ns/file", cli.uploadURL(context.Background(), "ns", "file"))
+}
+
+func TestWithEndpointRequest(t *testing.T) {
+	var pinged bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pinged = true
+	}))
+	defer srv.Close()
+
+	cli, err := NewClient(Config{
+		Host:       "proxy.invalid",
+		UploadPort: 1111,
+		ReadPort:   80,
+	}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	ctx := WithEndpoint(context.Background(), "127.0.0.1", serverPort(t, srv))
+	assert.NoError(t, cli.Ping(ctx))
+	assert.True(t, pinged)
+}
+
+func TestHostHeader(t *testing.T) {
+	var hosts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+	}))
+	defer srv.Close()
+
+	port := serverPort(t, srv)
+	cli, err := NewClient(Config{
+		Host:       "127.0.0.1",
+		UploadPort: port,
+		ReadPort:   port,
+		HostHeader: "canary.proxy.net:8080",
+	}, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	ctx := context.Background()
+	assert.NoError(t, cli.Ping(ctx))
+	assert.NoError(t, cli.Delete(ctx, "ns", "1/key"))
+	assert.Equal(t, []string{"canary.proxy.net:8080", "canary.proxy.net:8080"}, hosts)
+
+	for _, invalid := range []string{"http://proxy.net", "proxy.net/path", "proxy net", "proxy.net:port", "user@proxy.net", ":80"} {
+		_, err = NewClient(Config{Host: "127.0.0.1", HostHeader: invalid}, nil)
+		assert.Error(t, err, invalid)
+	}
+}